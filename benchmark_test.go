@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+const benchLength = 1000
+
+// BenchmarkGol runs 512x512 for benchLength turns using 1-16 worker threads.
+// Run it against an older revision with the same flags to compare designs, e.g.
+// go test -run ^$ -bench BenchmarkGol -benchtime 3x
+func BenchmarkGol(b *testing.B) {
+	stdout := os.Stdout
+	os.Stdout = nil // Disable all program output apart from benchmark results
+	defer func() { os.Stdout = stdout }()
+	for threads := 1; threads <= 16; threads++ {
+		p := gol.Params{
+			Turns:       benchLength,
+			Threads:     threads,
+			ImageWidth:  512,
+			ImageHeight: 512,
+		}
+		name := fmt.Sprintf("%dx%dx%d-%d", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				events := make(chan gol.Event)
+				go gol.Run(p, events, nil)
+				for range events {
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkLargerThanLife runs 512x512, and 1024x1024 tiled with it, for 10 turns under radius 10 Larger
+// than Life rules using 8 worker threads.
+func BenchmarkLargerThanLife(b *testing.B) {
+	stdout := os.Stdout
+	os.Stdout = nil // Disable all program output apart from benchmark results
+	defer func() { os.Stdout = stdout }()
+	dir, err := ioutil.TempDir("", "gol")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tiled := filepath.Join(dir, "1024x1024.pgm")
+	writeTiledImage(b, tiled, readAliveCells("images/512x512.pgm", 512, 512), 512, 1024)
+
+	for _, rule := range []string{"R10,C0,M1,S123..212,B123..170,NM", "R10,C0,M1,S65..110,B65..90,NN"} {
+		for _, size := range []int{512, 1024} {
+			p := gol.Params{
+				Turns:       10,
+				Threads:     8,
+				ImageWidth:  size,
+				ImageHeight: size,
+				Rule:        rule,
+			}
+			if size == 1024 {
+				p.Input = tiled
+			}
+			b.Run(fmt.Sprintf("%s/%dx%d", rule, size, size), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					events := make(chan gol.Event)
+					go gol.Run(p, events, nil)
+					for range events {
+					}
+				}
+			})
+		}
+	}
+}
+
+// writeTiledImage writes a size x size PGM image to path, tiled with a tileSize x tileSize image of alive cells.
+func writeTiledImage(b *testing.B, path string, alive []util.Cell, tileSize, size int) {
+	pixels := make([]byte, size*size)
+	for tileY := 0; tileY < size; tileY += tileSize {
+		for tileX := 0; tileX < size; tileX += tileSize {
+			for _, cell := range alive {
+				pixels[(tileY+cell.Y)*size+tileX+cell.X] = 255
+			}
+		}
+	}
+	image := append([]byte(fmt.Sprintf("P5\n%d %d\n255\n", size, size)), pixels...)
+	if err := ioutil.WriteFile(path, image, 0644); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkHaloExchange measures the bytes sent to and from 4 distributed workers on loopback per turn, for
+// the 512x512 image and a 5120x5120 world tiled with it. The halo benchmarks run the world with gol.Run
+// without a window, so workers only exchange their first and last rows, which grows with the width of the
+// world rather than its area. The flips benchmarks run it for a window, so workers also send back every
+// cell that flipped, which grows with how active the world is. The gathered benchmarks are the baseline of
+// a broker that held the world itself, which has to send every strip out and gather it back in every turn.
+func BenchmarkHaloExchange(b *testing.B) {
+	stdout := os.Stdout
+	os.Stdout = nil // Disable all program output apart from benchmark results
+	defer func() { os.Stdout = stdout }()
+	dir, err := ioutil.TempDir("", "gol")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	image := readAliveCells("images/512x512.pgm", 512, 512)
+	for _, size := range []int{512, 5120} {
+		input := filepath.Join(dir, fmt.Sprintf("%dx%d.pgm", size, size))
+		writeTiledImage(b, input, image, 512, size)
+
+		for _, mode := range []string{"halo", "flips"} {
+			b.Run(fmt.Sprintf("%dx%d/%s", size, size, mode), func(b *testing.B) {
+				var transferred int64
+				broker, stop := startCluster(b, 4, &transferred)
+				defer stop()
+				//Starting and finishing the run send the whole world, so only the turns in between are counted
+				p := gol.Params{
+					Turns:       b.N + 1,
+					Threads:     1,
+					ImageWidth:  size,
+					ImageHeight: size,
+					Input:       input,
+					Broker:      broker,
+					Headless:    mode == "halo",
+				}
+				events := make(chan gol.Event)
+				go gol.Run(p, events, nil)
+				var start, end int64
+				for event := range events {
+					if e, ok := event.(gol.TurnComplete); ok {
+						switch e.CompletedTurns {
+						case 1:
+							start = atomic.LoadInt64(&transferred)
+							b.ResetTimer()
+						case p.Turns:
+							end = atomic.LoadInt64(&transferred)
+							b.StopTimer()
+						}
+					}
+				}
+				b.ReportMetric(float64(end-start)/float64(b.N), "B/turn")
+			})
+		}
+
+		b.Run(fmt.Sprintf("%dx%d/gathered", size, size), func(b *testing.B) {
+			var transferred int64
+			broker, stop := startCluster(b, 4, &transferred)
+			defer stop()
+			client, err := rpc.Dial("tcp", broker)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer client.Close()
+			var world gol.BoardRows
+			if err := client.Call("Broker.Start", gol.StartRequest{Rule: "B3/S23", World: tiledRows(image, size)}, new(int)); err != nil {
+				b.Fatal(err)
+			}
+			if err := client.Call("Broker.Snapshot", 0, &world); err != nil {
+				b.Fatal(err)
+			}
+
+			atomic.StoreInt64(&transferred, 0)
+			b.ResetTimer()
+			for turn := 0; turn < b.N; turn++ {
+				if err := client.Call("Broker.Start", gol.StartRequest{Rule: "B3/S23", World: world}, new(int)); err != nil {
+					b.Fatal(err)
+				}
+				if err := client.Call("Broker.Step", gol.StepRequest{Turn: turn}, new(gol.StepReply)); err != nil {
+					b.Fatal(err)
+				}
+				world = gol.BoardRows{}
+				if err := client.Call("Broker.Snapshot", 0, &world); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(atomic.LoadInt64(&transferred))/float64(b.N), "B/turn")
+		})
+	}
+}
+
+// tiledRows returns a size x size world tiled with a 512x512 image of alive cells.
+func tiledRows(alive []util.Cell, size int) gol.BoardRows {
+	stride := (size + 63) / 64
+	world := gol.BoardRows{Width: size, Height: size, Words: make([]uint64, stride*size)}
+	for tileY := 0; tileY < size; tileY += 512 {
+		for tileX := 0; tileX < size; tileX += 512 {
+			for _, cell := range alive {
+				x, y := tileX+cell.X, tileY+cell.Y
+				world.Words[y*stride+x/64] |= 1 << uint(x%64)
+			}
+		}
+	}
+	return world
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// main starts a broker, which workers register with and controllers run the game of life on,
+// e.g. 'go run ./broker -listen :8030'
+func main() {
+	listen := flag.String(
+		"listen",
+		":8030",
+		"Specify the address to accept controllers and workers on. Defaults to :8030.")
+
+	flag.Parse()
+
+	l, err := net.Listen("tcp", *listen)
+	if err == nil {
+		fmt.Println("Broker listening on", l.Addr())
+		err = gol.ServeBroker(l)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestBus subscribes to a 64x64 run with every policy, and checks that a subscriber that blocks sees every
+// turn, one filtered to TurnComplete events sees nothing else, and ones that drop or coalesce events don't
+// hold up the run even though they aren't read until it has finished. Coalesced events still add up to the
+// final world, including the states of a Generations rule.
+func TestBus(t *testing.T) {
+	tests := []struct {
+		name string
+		p    gol.Params
+	}{
+		{"64x64", gol.Params{Turns: 100, Threads: 4, ImageWidth: 64, ImageHeight: 64}},
+		{"generations", gol.Params{Turns: 100, Threads: 4, ImageWidth: 16, ImageHeight: 16, Rule: "B2/S345/C4"}},
+		{"flipped events", gol.Params{Turns: 100, Threads: 4, ImageWidth: 64, ImageHeight: 64, CellFlippedEvents: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := test.p
+			run := make(chan gol.Event)
+			bus := gol.NewBus(run)
+			blocking, turns := make(chan gol.Event), make(chan gol.Event)
+			dropping, coalescing := make(chan gol.Event), make(chan gol.Event)
+			bus.Subscribe(blocking, gol.Subscription{})
+			bus.Subscribe(turns, gol.Subscription{Types: []gol.Event{gol.TurnComplete{}}, Policy: gol.DropOldest})
+			bus.Subscribe(dropping, gol.Subscription{Policy: gol.DropOldest, Buffer: 10})
+			bus.Subscribe(coalescing, gol.Subscription{Policy: gol.Coalesce})
+
+			c, err := gol.Start(context.Background(), p, run)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blocked := make(chan []gol.Event)
+			go func() {
+				var events []gol.Event
+				for event := range blocking {
+					events = append(events, event)
+				}
+				blocked <- events
+			}()
+			if err := c.Wait(); err != nil {
+				t.Fatal(err)
+			}
+
+			//The run has finished, so every subscriber has been sent or kept all the events it will get
+			events := <-blocked
+			final, ok := events[len(events)-2].(gol.FinalTurnComplete)
+			if !ok {
+				t.Fatalf("expected FinalTurnComplete before the last event, got %v", events[len(events)-2])
+			}
+			expected := 0
+			for event := range turns {
+				if e, ok := event.(gol.TurnComplete); !ok || e.CompletedTurns != expected+1 {
+					t.Fatalf("expected turn %d to complete, got %#v", expected+1, event)
+				}
+				expected++
+			}
+			if expected != p.Turns {
+				t.Errorf("expected %d turns to complete, got %d", p.Turns, expected)
+			}
+			var dropped []gol.Event
+			for event := range dropping {
+				dropped = append(dropped, event)
+			}
+			//The event being sent when the subscriber fell behind is sent as well as the 10 kept
+			if len(dropped) != 11 || !reflect.DeepEqual(dropped[1:], events[len(events)-10:]) {
+				t.Errorf("expected the last 10 events to be kept, got %v", dropped)
+			}
+
+			states, turn := make(map[util.Cell]uint8), 0
+			for event := range coalescing {
+				switch e := event.(type) {
+				case gol.CellFlipped:
+					t.Fatalf("CellFlipped event on turn %d wasn't coalesced", e.CompletedTurns)
+				case gol.TurnComplete:
+					turn = e.CompletedTurns
+				}
+				applyCells(states, event)
+			}
+			if turn != p.Turns {
+				t.Errorf("expected the coalesced turns to end on turn %d, got %d", p.Turns, turn)
+			}
+			assertEqualBoard(t, aliveIn(states), final.Alive, p)
+		})
+	}
+}
+
+// TestBusUnsubscribe checks that a subscriber that blocks the run stops holding it up once it unsubscribes,
+// and that its channel is closed.
+func TestBusUnsubscribe(t *testing.T) {
+	p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 64, ImageHeight: 64}
+	run := make(chan gol.Event)
+	bus := gol.NewBus(run)
+	events := make(chan gol.Event)
+	bus.Subscribe(events, gol.Subscription{})
+	c, err := gol.Start(context.Background(), p, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-events
+	bus.Unsubscribe(events)
+	if err := c.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	for range events {
+	}
+}
+
+// TestWindowEvents subscribes the window to a 64x64 run as main does, and checks that the first event it is
+// sent is the CellsFlipped event of the initial world even though it starts reading late, and that the
+// events it is sent add up to the final world. Without the window, the final turn is always waited for.
+func TestWindowEvents(t *testing.T) {
+	for _, noVis := range []bool{false, true} {
+		p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 64, ImageHeight: 64}
+		run := make(chan gol.Event, 1000)
+		bus := gol.NewBus(run)
+		window := subscribe(bus, noVis)
+		c, err := gol.Start(context.Background(), p, run)
+		if err != nil {
+			t.Fatal(err)
+		}
+		//The window takes a while to open before it reads its first event
+		time.Sleep(20 * time.Millisecond)
+
+		first := <-window
+		if noVis {
+			if e, ok := first.(gol.FinalTurnComplete); !ok || e.CompletedTurns != p.Turns {
+				t.Errorf("expected the final turn without the window, got %#v", first)
+			}
+		} else {
+			initial := p
+			initial.Turns = 0
+			e, ok := first.(gol.CellsFlipped)
+			if !ok || e.CompletedTurns != 0 {
+				t.Fatalf("expected the CellsFlipped event of the initial world first, got %v", first)
+			}
+			assertEqualBoard(t, e.Cells, runFinal(initial), p)
+			states := make(map[util.Cell]uint8)
+			applyCells(states, first)
+			var final gol.FinalTurnComplete
+			for event := range window {
+				if e, ok := event.(gol.FinalTurnComplete); ok {
+					final = e
+				}
+				applyCells(states, event)
+			}
+			if final.CompletedTurns != p.Turns {
+				t.Fatalf("expected the final turn %d, got %d", p.Turns, final.CompletedTurns)
+			}
+			assertEqualBoard(t, aliveIn(states), final.Alive, p)
+		}
+		bus.Unsubscribe(window)
+		if err := c.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestCheckpoint saves a checkpoint at the end of a run of 50 turns (or 49, as workers double buffer the edges
+// of the world by turn), and checks that resuming from it carries on counting turns from there and ends with the
+// same world as an uninterrupted run, including when it is resumed on another engine or a broker.
+func TestCheckpoint(t *testing.T) {
+	broker, stop := startCluster(t, 2, nil)
+	defer stop()
+	tests := []struct {
+		name                string
+		saved, resumed      gol.Params
+		turn                int
+		golden              string
+		x, y, width, height int
+	}{
+		{name: "parallel",
+			saved:   gol.Params{Threads: 4, ImageWidth: 64, ImageHeight: 64},
+			resumed: gol.Params{Threads: 3},
+			golden:  "check/images/64x64x100.pgm", width: 64, height: 64},
+		{name: "distributed",
+			saved:   gol.Params{Threads: 4, ImageWidth: 64, ImageHeight: 64},
+			resumed: gol.Params{Broker: broker},
+			golden:  "check/images/64x64x100.pgm", width: 64, height: 64},
+		{name: "plane",
+			saved:   gol.Params{Threads: 4, ImageWidth: 64, ImageHeight: 64, Topology: gol.Plane},
+			resumed: gol.Params{Threads: 4},
+			golden:  "check/topologies/plane/64x64x100.pgm", width: 64, height: 64},
+		{name: "odd turn",
+			saved:   gol.Params{Threads: 4, ImageWidth: 512, ImageHeight: 512},
+			resumed: gol.Params{Threads: 4}, turn: 49,
+			golden: "check/images/512x512x100.pgm", width: 512, height: 512},
+		{name: "unbounded",
+			saved:   gol.Params{Threads: 4, ImageWidth: 64, ImageHeight: 64, Unbounded: true},
+			resumed: gol.Params{Threads: 4},
+			golden:  "check/unbounded/64x64x100.pgm", x: -6, y: -5, width: 81, height: 101},
+		{name: "unbounded hashlife",
+			saved:   gol.Params{Threads: 4, ImageWidth: 64, ImageHeight: 64, Unbounded: true},
+			resumed: gol.Params{Engine: gol.HashLife},
+			golden:  "check/unbounded/64x64x100.pgm", x: -6, y: -5, width: 81, height: 101},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "checkpoint")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			turn := test.turn
+			if turn == 0 {
+				turn = 50
+			}
+			saved := test.saved
+			saved.Turns, saved.CheckpointDir = turn, dir
+			runFinal(saved)
+			checkpoints, _ := filepath.Glob(filepath.Join(dir, "*"))
+			if len(checkpoints) != 1 || filepath.Base(checkpoints[0]) != fmt.Sprintf("%dx%dx%d.checkpoint", saved.ImageHeight, saved.ImageWidth, turn) {
+				t.Fatalf("expected a single checkpoint for turn %d, found %v", turn, checkpoints)
+			}
+
+			resumed := test.resumed
+			resumed.Turns, resumed.Resume = 100, checkpoints[0]
+			var expected []util.Cell
+			for _, cell := range readAliveCells(test.golden, test.width, test.height) {
+				expected = append(expected, util.Cell{X: cell.X + test.x, Y: cell.Y + test.y})
+			}
+			assertEqualBoard(t, runResumed(t, resumed, turn), expected, saved)
+		})
+	}
+}
+
+// TestCheckpointInterval checks that checkpoints are saved while a world is running, that only the latest
+// is kept, and that a run can be resumed from it.
+func TestCheckpointInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := gol.Params{Turns: 1000000000, Threads: 2, ImageWidth: 16, ImageHeight: 16, Rule: "B2/S345/C4",
+		CheckpointDir: dir, CheckpointInterval: 10 * time.Millisecond}
+	events := make(chan gol.Event)
+	keyPresses := make(chan rune, 1)
+	go gol.Run(p, events, keyPresses)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		keyPresses <- 'q'
+	}()
+	var final gol.FinalTurnComplete
+	for event := range events {
+		if e, ok := event.(gol.FinalTurnComplete); ok {
+			final = e
+		}
+	}
+
+	//The run saves a last checkpoint as it quits
+	checkpoints, _ := filepath.Glob(filepath.Join(dir, "*"))
+	expected := filepath.Join(dir, fmt.Sprintf("16x16x%d.checkpoint", final.CompletedTurns))
+	if len(checkpoints) != 1 || checkpoints[0] != expected {
+		t.Fatalf("expected only %v, found %v", expected, checkpoints)
+	}
+	resumed, err := gol.ResumeParams(gol.Params{Turns: final.CompletedTurns + 10, Threads: 2, Resume: expected})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Rule != "B2/S345/C4" || resumed.ImageWidth != 16 || resumed.ImageHeight != 16 {
+		t.Errorf("resumed with params %+v, expected the rule and size of the checkpoint", resumed)
+	}
+	assertEqualBoard(t, runResumed(t, resumed, final.CompletedTurns),
+		runFinal(gol.Params{Turns: final.CompletedTurns + 10, Threads: 2, ImageWidth: 16, ImageHeight: 16, Rule: "B2/S345/C4"}), resumed)
+}
+
+// TestInvalidCheckpoint checks that gol.Run rejects checkpoints that are missing or malformed.
+func TestInvalidCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	malformed := filepath.Join(dir, "malformed.checkpoint")
+	if err := ioutil.WriteFile(malformed, []byte("P2\n16 16\n255\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(dir, "missing.checkpoint"), malformed} {
+		events := make(chan gol.Event)
+		if err := gol.Run(gol.Params{Turns: 1, Threads: 1, Resume: path}, events, nil); err == nil {
+			t.Errorf("expected an error resuming from %v", path)
+		}
+		if _, ok := <-events; ok {
+			t.Errorf("expected events to be closed after resuming from %v failed", path)
+		}
+	}
+}
+
+// runResumed runs a world resumed from a checkpoint saved on turn, checks that every event carries on
+// from that turn, and returns the alive cells of its FinalTurnComplete event.
+func runResumed(t *testing.T, p gol.Params, turn int) []util.Cell {
+	events := make(chan gol.Event)
+	go func() {
+		if err := gol.Run(p, events, nil); err != nil {
+			t.Error(err)
+		}
+	}()
+	var final []util.Cell
+	for event := range events {
+		switch e := event.(type) {
+		case gol.CellsFlipped:
+			if e.CompletedTurns < turn {
+				t.Fatalf("cell flipped on turn %d, before the checkpoint on turn %d", e.CompletedTurns, turn)
+			}
+		case gol.TurnComplete:
+			//HashLife leaps ahead by more than a turn at a time
+			if e.CompletedTurns <= turn {
+				t.Fatalf("turn %d completed after turn %d", e.CompletedTurns, turn)
+			}
+			turn = e.CompletedTurns
+		case gol.FinalTurnComplete:
+			final = e.Alive
+		}
+	}
+	return final
+}
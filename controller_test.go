@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestController pauses, steps, snapshots, saves and quits a 64x64 run through its Controller, and checks
+// each world against an uninterrupted run of the same number of turns.
+func TestController(t *testing.T) {
+	p := gol.Params{Turns: 1000000000, Threads: 4, ImageWidth: 64, ImageHeight: 64}
+	events := make(chan gol.Event, 1000)
+	c, err := gol.Start(context.Background(), p, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for range events {
+		}
+	}()
+	expected := func(turns int) gol.Params {
+		return gol.Params{Turns: turns, Threads: 4, ImageWidth: 64, ImageHeight: 64}
+	}
+
+	paused, err := c.Pause()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Pause(); err != gol.ErrPaused {
+		t.Errorf("expected %v pausing a paused run, got %v", gol.ErrPaused, err)
+	}
+	alive, turn, err := c.Snapshot()
+	if err != nil || turn != paused {
+		t.Fatalf("snapshot of turn %d while paused on turn %d: %v", turn, paused, err)
+	}
+	assertEqualBoard(t, alive, runFinal(expected(turn)), p)
+
+	if turn, err = c.Step(5); err != nil || turn != paused+5 {
+		t.Fatalf("stepped to turn %d from turn %d: %v", turn, paused, err)
+	}
+	if _, err := c.Step(0); err == nil {
+		t.Error("expected an error stepping 0 turns")
+	}
+	alive, _, _ = c.Snapshot()
+	assertEqualBoard(t, alive, runFinal(expected(turn)), p)
+
+	dir, err := ioutil.TempDir("", "controller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "saved.pgm")
+	if saved, err := c.Save(path); err != nil || saved != turn {
+		t.Fatalf("saved turn %d on turn %d: %v", saved, turn, err)
+	}
+	assertEqualBoard(t, readAliveCells(path, 64, 64), alive, p)
+	if _, err := c.Save(filepath.Join(dir, "saved.txt")); err == nil {
+		t.Error("expected an error saving in an unknown format")
+	}
+
+	if _, err := c.Resume(); err != nil {
+		t.Error(err)
+	}
+	if _, err := c.Resume(); err != gol.ErrNotPaused {
+		t.Errorf("expected %v resuming a running run, got %v", gol.ErrNotPaused, err)
+	}
+	if _, err := c.Step(1); err != gol.ErrNotPaused {
+		t.Errorf("expected %v stepping a running run, got %v", gol.ErrNotPaused, err)
+	}
+	if err := c.Quit(); err != nil {
+		t.Error(err)
+	}
+	if _, err := c.Pause(); err != gol.ErrFinished {
+		t.Errorf("expected %v pausing a finished run, got %v", gol.ErrFinished, err)
+	}
+}
+
+// TestControllerContext checks that cancelling the context of a run quits it, with its final world.
+func TestControllerContext(t *testing.T) {
+	p := gol.Params{Turns: 1000000000, Threads: 4, ImageWidth: 16, ImageHeight: 16}
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan gol.Event)
+	c, err := gol.Start(ctx, p, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	var final gol.FinalTurnComplete
+	for event := range events {
+		if e, ok := event.(gol.FinalTurnComplete); ok {
+			final = e
+		}
+	}
+	if err := c.Wait(); err != nil {
+		t.Error(err)
+	}
+	assertEqualBoard(t, final.Alive, runFinal(gol.Params{Turns: final.CompletedTurns, Threads: 4, ImageWidth: 16, ImageHeight: 16}), p)
+
+	events = make(chan gol.Event)
+	if _, err := gol.Start(ctx, gol.Params{Turns: 1, Threads: 1, ImageWidth: 16, ImageHeight: 16, Rule: "B9/S"}, events); err == nil {
+		t.Error("expected an error starting a run with an invalid rule")
+	}
+	if _, ok := <-events; ok {
+		t.Error("expected events to be closed after starting failed")
+	}
+}
+
+// TestBack steps paused runs on every engine forward and then back through the turns they keep, and checks
+// that the events sent stepping back leave a window showing the same cells as it did on each turn, and
+// that the run carries on from there as if it had never been stepped back.
+func TestBack(t *testing.T) {
+	broker, stop := startCluster(t, 2, nil)
+	defer stop()
+	//A blinker in an unbounded universe has to grow back to its full width when it is stepped back
+	dir, err := ioutil.TempDir("", "back")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	blinker := filepath.Join(dir, "blinker.rle")
+	if err := ioutil.WriteFile(blinker, []byte("x = 3, y = 1\n3o!\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		p    gol.Params
+	}{
+		{"parallel", gol.Params{Threads: 4, ImageWidth: 64, ImageHeight: 64}},
+		{"generations", gol.Params{Threads: 4, ImageWidth: 64, ImageHeight: 64, Rule: "B2/S345/C4"}},
+		{"unbounded", gol.Params{Threads: 4, ImageWidth: 64, ImageHeight: 64, Unbounded: true}},
+		{"unbounded blinker", gol.Params{Threads: 1, ImageWidth: 3, ImageHeight: 1, Unbounded: true, Input: blinker}},
+		{"hashlife", gol.Params{ImageWidth: 64, ImageHeight: 64, Engine: gol.HashLife}},
+		{"distributed", gol.Params{ImageWidth: 64, ImageHeight: 64, Broker: broker}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := test.p
+			p.Turns, p.History = 1000000000, 3
+			events := make(chan gol.Event)
+			c, err := gol.Start(context.Background(), p, events)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := newWindow(events)
+			paused, err := c.Pause()
+			if err != nil {
+				t.Fatal(err)
+			}
+			frames := map[int]map[util.Cell]uint8{paused: w.frame(paused)}
+			for i := 1; i <= 5; i++ {
+				turn, err := c.Step(1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				frames[turn] = w.frame(turn)
+			}
+
+			for i := 1; i <= 3; i++ {
+				turn, err := c.Back()
+				if err != nil || turn != paused+5-i {
+					t.Fatalf("stepped back to turn %d from turn %d: %v", turn, paused+6-i, err)
+				}
+				frame := w.frame(turn)
+				if !reflect.DeepEqual(frame, frames[turn]) {
+					t.Fatalf("the window doesn't show turn %d after stepping back to it", turn)
+				}
+				alive, _, _ := c.Snapshot()
+				assertEqualBoard(t, alive, aliveIn(frame), p)
+			}
+			if _, err := c.Back(); err != gol.ErrNoHistory {
+				t.Errorf("expected %v stepping back past the history, got %v", gol.ErrNoHistory, err)
+			}
+
+			turn, err := c.Step(2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(w.frame(turn), frames[turn]) {
+				t.Errorf("turn %d differs after stepping back and forward again", turn)
+			}
+			if _, err := c.Resume(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.Back(); err != gol.ErrNotPaused {
+				t.Errorf("expected %v stepping back a running run, got %v", gol.ErrNotPaused, err)
+			}
+			if err := c.Quit(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// window keeps the state of every cell that isn't dead from the events of a run, as a window does.
+type window struct {
+	mu     sync.Mutex
+	turned *sync.Cond
+	turn   int
+	states map[util.Cell]uint8
+}
+
+// newWindow starts showing events in a window.
+func newWindow(events <-chan gol.Event) *window {
+	w := &window{states: make(map[util.Cell]uint8)}
+	w.turned = sync.NewCond(&w.mu)
+	go func() {
+		for event := range events {
+			w.mu.Lock()
+			switch e := event.(type) {
+			case gol.CellsFlipped:
+				for _, cell := range e.Cells {
+					if w.states[cell] == 1 {
+						delete(w.states, cell)
+					} else {
+						w.states[cell] = 1
+					}
+				}
+			case gol.CellStateChanged:
+				if e.State == 0 {
+					delete(w.states, e.Cell)
+				} else {
+					w.states[e.Cell] = e.State
+				}
+			case gol.TurnComplete:
+				w.turn = e.CompletedTurns
+				w.turned.Broadcast()
+			}
+			w.mu.Unlock()
+		}
+	}()
+	return w
+}
+
+// frame waits for the window to show turn, and returns a copy of the states of its cells.
+func (w *window) frame(turn int) map[util.Cell]uint8 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.turn != turn {
+		w.turned.Wait()
+	}
+	frame := make(map[util.Cell]uint8)
+	for cell, state := range w.states {
+		frame[cell] = state
+	}
+	return frame
+}
+
+// aliveIn returns the alive cells of a frame.
+func aliveIn(frame map[util.Cell]uint8) []util.Cell {
+	var alive []util.Cell
+	for cell, state := range frame {
+		if state == 1 {
+			alive = append(alive, cell)
+		}
+	}
+	return alive
+}
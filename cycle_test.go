@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestCycle checks that the glider on a 16x16 torus, with a window or without, the 64x64 world and a
+// Generations world are found to be periodic on the turn they first repeat, and that a run stopped there ends
+// with the world it would have after 10 billion turns. HashLife leaps over cycles without detecting them.
+func TestCycle(t *testing.T) {
+	tests := []struct {
+		name          string
+		p             gol.Params
+		start, period int
+	}{
+		{"glider", gol.Params{Threads: 4, ImageWidth: 16, ImageHeight: 16}, 0, 64},
+		{"headless", gol.Params{Threads: 4, ImageWidth: 16, ImageHeight: 16, Headless: true}, 0, 64},
+		{"64x64", gol.Params{Threads: 4, ImageWidth: 64, ImageHeight: 64}, 1575, 2},
+		{"generations", gol.Params{Threads: 4, ImageWidth: 16, ImageHeight: 16, Rule: "B2/S345/C4"}, 42, 12},
+		{"hashlife", gol.Params{ImageWidth: 16, ImageHeight: 16, Engine: gol.HashLife}, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := test.p
+			p.Turns, p.StopOnCycle = 10000000000, test.period > 0
+			if test.period == 0 {
+				p.Turns = 1000
+			}
+			cycles, final := runCycle(t, p)
+			if test.period == 0 {
+				if len(cycles) > 0 {
+					t.Errorf("expected no cycles, found %v", cycles)
+				}
+				return
+			}
+			expected := gol.CycleDetected{CompletedTurns: test.start + test.period, Start: test.start, Period: test.period}
+			if len(cycles) != 1 || cycles[0] != expected {
+				t.Fatalf("expected %v, found %v", []gol.CycleDetected{expected}, cycles)
+			}
+			equivalent := p
+			equivalent.Turns, equivalent.StopOnCycle = test.start+(p.Turns-test.start)%test.period, false
+			assertEqualBoard(t, final, runFinal(equivalent), p)
+		})
+	}
+}
+
+// TestCycle512 checks that the 512x512 world is found to settle into a period 2 oscillation, with the alive
+// cells counted after an even number of turns in count_test.go.
+func TestCycle512(t *testing.T) {
+	p := gol.Params{Turns: 10000000000, Threads: 8, ImageWidth: 512, ImageHeight: 512, StopOnCycle: true}
+	cycles, final := runCycle(t, p)
+	if len(cycles) != 1 || cycles[0].Period != 2 || cycles[0].Start > 10000 {
+		t.Errorf("expected a period 2 cycle starting by turn 10000, found %v", cycles)
+	}
+	if len(final) != 5565 {
+		t.Errorf("expected 5565 alive cells after %d turns, got %d", p.Turns, len(final))
+	}
+}
+
+// TestCycleContinues checks that a run that isn't stopped on a cycle carries on after finding it.
+func TestCycleContinues(t *testing.T) {
+	p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 16, ImageHeight: 16}
+	cycles, final := runCycle(t, p)
+	if len(cycles) != 1 || cycles[0].CompletedTurns != 64 {
+		t.Errorf("expected a single cycle found on turn 64, found %v", cycles)
+	}
+	assertEqualBoard(t, final, readAliveCells("check/images/16x16x100.pgm", 16, 16), p)
+}
+
+// runCycle runs p, checking that its last turn completed is the final turn, and returns its CycleDetected
+// events and final alive cells.
+func runCycle(t *testing.T, p gol.Params) ([]gol.CycleDetected, []util.Cell) {
+	events := make(chan gol.Event)
+	go func() {
+		if err := gol.Run(p, events, nil); err != nil {
+			t.Error(err)
+		}
+	}()
+	var cycles []gol.CycleDetected
+	var final gol.FinalTurnComplete
+	turn := 0
+	for event := range events {
+		switch e := event.(type) {
+		case gol.CycleDetected:
+			cycles = append(cycles, e)
+		case gol.TurnComplete:
+			turn = e.CompletedTurns
+		case gol.FinalTurnComplete:
+			final = e
+		}
+	}
+	if final.CompletedTurns != p.Turns || turn != p.Turns {
+		t.Errorf("final turn %d completed after turn %d, expected %d", final.CompletedTurns, turn, p.Turns)
+	}
+	return cycles, final.Alive
+}
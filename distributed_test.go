@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestDistributed tests 16x16, 64x64 and 512x512 images on 0, 1 and 100 turns on a broker with 1 and 4 workers
+// on loopback, 512x512 on 100 turns without flipped cells, and 64x64 images on 100 turns on the topologies and
+// under the Generations rule that workers support.
+func TestDistributed(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		broker, stop := startCluster(t, workers, nil)
+		for _, size := range []int{16, 64, 512} {
+			for _, turns := range []int{0, 1, 100} {
+				p := gol.Params{Turns: turns, Threads: 1, ImageWidth: size, ImageHeight: size, Broker: broker}
+				expectedAlive := readAliveCells(fmt.Sprintf("check/images/%vx%vx%v.pgm", size, size, turns), size, size)
+				t.Run(fmt.Sprintf("%d/%dx%dx%d", workers, size, size, turns), func(t *testing.T) {
+					assertEqualBoard(t, runFinal(p), expectedAlive, p)
+				})
+			}
+		}
+		stop()
+	}
+
+	broker, stop := startCluster(t, 3, nil)
+	defer stop()
+	for _, topology := range []gol.Topology{gol.Plane, gol.Cylinder, gol.KleinBottle} {
+		p := gol.Params{Turns: 100, Threads: 1, ImageWidth: 64, ImageHeight: 64, Topology: topology, Broker: broker}
+		t.Run(topology.String(), func(t *testing.T) {
+			assertEqualBoard(t, runFinal(p), readAliveCells(fmt.Sprintf("check/topologies/%v/64x64x100.pgm", topology), 64, 64), p)
+		})
+	}
+	t.Run("headless", func(t *testing.T) {
+		p := gol.Params{Turns: 100, Threads: 1, ImageWidth: 512, ImageHeight: 512, Broker: broker, Headless: true}
+		assertEqualBoard(t, runFinal(p), readAliveCells("check/images/512x512x100.pgm", 512, 512), p)
+	})
+	t.Run("B2/S345/C4", func(t *testing.T) {
+		p := gol.Params{Turns: 100, Threads: 1, ImageWidth: 64, ImageHeight: 64, Rule: "B2/S345/C4", Broker: broker}
+		runFinal(p)
+		if !bytes.Equal(readPgmPixels(t, "out/64x64x100.pgm"), readPgmPixels(t, "check/rules/B2S345C4/64x64x100.pgm")) {
+			t.Error("output image grey levels don't match the expected dying cells")
+		}
+	})
+}
+
+// TestDistributedEvents checks that the CellsFlipped events reproduced by the controller add up to the final
+// alive cells, and that every turn is completed in order.
+func TestDistributedEvents(t *testing.T) {
+	broker, stop := startCluster(t, 2, nil)
+	defer stop()
+	p := gol.Params{Turns: 100, Threads: 1, ImageWidth: 64, ImageHeight: 64, Broker: broker}
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	alive := make(map[util.Cell]bool)
+	var final []util.Cell
+	lastTurn := 0
+	for event := range events {
+		switch e := event.(type) {
+		case gol.CellsFlipped:
+			for _, cell := range e.Cells {
+				alive[cell] = !alive[cell]
+			}
+		case gol.TurnComplete:
+			if e.CompletedTurns != lastTurn+1 {
+				t.Fatalf("turn %d completed after turn %d", e.CompletedTurns, lastTurn)
+			}
+			lastTurn = e.CompletedTurns
+		case gol.FinalTurnComplete:
+			final = e.Alive
+		}
+	}
+	var flipped []util.Cell
+	for cell, isAlive := range alive {
+		if isAlive {
+			flipped = append(flipped, cell)
+		}
+	}
+	assertEqualBoard(t, flipped, final, p)
+}
+
+// TestDistributedFaults kills worker processes on loopback part way through 100 turns of the 512x512 image,
+// and checks that the broker recovers their strips on the workers that are left and still gets it right, with
+// and without the flipped cells that keep the broker's copy of the world up to date. It also stops a worker
+// process without killing it, which only its heartbeat finds.
+func TestDistributedFaults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	worker := filepath.Join(dir, "worker")
+	if out, err := exec.Command("go", "build", "-o", worker, "./worker").CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+
+	for _, test := range []struct {
+		kills    map[int][]int
+		headless bool
+		signal   os.Signal
+	}{
+		{map[int][]int{10: {0}}, false, os.Kill},
+		{map[int][]int{1: {3}, 50: {1}, 99: {0}}, false, os.Kill},
+		{map[int][]int{25: {0, 1, 2}}, false, os.Kill},
+		{map[int][]int{1: {3}, 50: {1}, 99: {0}}, true, os.Kill},
+		{map[int][]int{30: {2}}, false, syscall.SIGSTOP},
+	} {
+		kills := test.kills
+		t.Run(fmt.Sprint(kills, test.headless, test.signal), func(t *testing.T) {
+			broker, stop := startCluster(t, 0, nil)
+			defer stop()
+			var processes []*os.Process
+			for i := 0; i < 4; i++ {
+				processes = append(processes, startWorkerProcess(t, worker, broker))
+			}
+			defer func() {
+				for _, process := range processes {
+					process.Kill()
+					process.Wait()
+				}
+			}()
+
+			p := gol.Params{Turns: 100, Threads: 1, ImageWidth: 512, ImageHeight: 512, Broker: broker, Headless: test.headless}
+			events := make(chan gol.Event)
+			go gol.Run(p, events, nil)
+			var final []util.Cell
+			workers := 4
+			for event := range events {
+				switch e := event.(type) {
+				case gol.TurnComplete:
+					for _, i := range kills[e.CompletedTurns] {
+						processes[i].Signal(test.signal)
+						workers--
+					}
+				case gol.ClusterChange:
+					if e.Workers != workers {
+						t.Errorf("expected the cluster to shrink to %d workers, not %d", workers, e.Workers)
+					}
+				case gol.FinalTurnComplete:
+					final = e.Alive
+				}
+			}
+			assertEqualBoard(t, final, readAliveCells("check/images/512x512x100.pgm", 512, 512), p)
+		})
+	}
+}
+
+// TestInvalidDistributed checks that gol.Run returns an error for a broker that isn't listening or has no
+// workers, and for worlds that workers don't support.
+func TestInvalidDistributed(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := l.Addr().String()
+	l.Close()
+	empty, stop := startCluster(t, 0, nil)
+	defer stop()
+
+	for _, p := range []gol.Params{
+		{Broker: closed},
+		{Broker: empty},
+		{Broker: empty, Topology: gol.CrossSurface},
+		{Broker: empty, Rule: "R2,C0,M0,S3..5,B3..4,NN"},
+		{Broker: empty, Unbounded: true},
+		{Broker: empty, Engine: gol.HashLife},
+	} {
+		p.Turns, p.Threads, p.ImageWidth, p.ImageHeight = 1, 1, 16, 16
+		events := make(chan gol.Event)
+		errors := make(chan error)
+		go func() {
+			errors <- gol.Run(p, events, nil)
+		}()
+		for range events {
+		}
+		if err := <-errors; err == nil {
+			t.Errorf("expected an error for %+v", p)
+		}
+	}
+}
+
+// TestDistributedWorkerFailure checks that a worker that fails part way through a run, without exchanging halo
+// rows with its neighbours, is dropped and the run carries on without it, and that gol.Run returns an error
+// rather than hanging once every worker has failed.
+func TestDistributedWorkerFailure(t *testing.T) {
+	for _, workers := range []int{2, 0} {
+		t.Run(fmt.Sprint(workers), func(t *testing.T) {
+			broker, stop := startCluster(t, workers, nil)
+			defer stop()
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			server := rpc.NewServer()
+			server.RegisterName("Worker", new(failingWorker))
+			go server.Accept(l)
+			client, err := rpc.Dial("tcp", broker)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = client.Call("Broker.Register", l.Addr().String(), new(int))
+			client.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p := gol.Params{Turns: 100, Threads: 1, ImageWidth: 64, ImageHeight: 64, Broker: broker}
+			events := make(chan gol.Event)
+			errors := make(chan error)
+			go func() {
+				errors <- gol.Run(p, events, nil)
+			}()
+			var final []util.Cell
+			shrunk := false
+			for event := range events {
+				switch e := event.(type) {
+				case gol.ClusterChange:
+					shrunk = e.Workers == workers
+				case gol.FinalTurnComplete:
+					final = e.Alive
+				}
+			}
+			err = <-errors
+			if workers == 0 {
+				if err == nil {
+					t.Error("expected an error once every worker has failed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !shrunk {
+				t.Errorf("expected the cluster to shrink to %d workers", workers)
+			}
+			assertEqualBoard(t, final, readAliveCells("check/images/64x64x100.pgm", 64, 64), p)
+		})
+	}
+}
+
+// failingWorker is a worker that accepts a strip, then fails on its first turn without sending or receiving
+// any halo rows, and stops answering heartbeats.
+type failingWorker struct {
+	failed int32
+}
+
+func (w *failingWorker) Setup(_ gol.SetupRequest, _ *bool) error {
+	return nil
+}
+
+func (w *failingWorker) Step(_ gol.StepRequest, _ *gol.StepReply) error {
+	atomic.StoreInt32(&w.failed, 1)
+	return fmt.Errorf("failed")
+}
+
+func (w *failingWorker) Ping(_ int, _ *bool) error {
+	if atomic.LoadInt32(&w.failed) != 0 {
+		return fmt.Errorf("failed")
+	}
+	return nil
+}
+
+// TestDistributedBusy checks that a broker turns away a second controller while another is running a world on
+// it, and accepts it once the first has finished.
+func TestDistributedBusy(t *testing.T) {
+	broker, stop := startCluster(t, 2, nil)
+	defer stop()
+	start := func() (*rpc.Client, error) {
+		client, err := rpc.Dial("tcp", broker)
+		if err != nil {
+			t.Fatal(err)
+		}
+		world := gol.BoardRows{Width: 16, Height: 16, Words: make([]uint64, 16)}
+		return client, client.Call("Broker.Start", gol.StartRequest{Rule: "B3/S23", World: world}, new(int))
+	}
+
+	first, err := start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := start()
+	if err == nil {
+		t.Error("expected an error starting a second controller")
+	}
+	if err := second.Call("Broker.Step", gol.StepRequest{}, new(gol.StepReply)); err == nil {
+		t.Error("expected an error stepping another controller's world")
+	}
+	if err := first.Call("Broker.Step", gol.StepRequest{}, new(gol.StepReply)); err != nil {
+		t.Error(err)
+	}
+	second.Close()
+
+	if err := first.Call("Broker.Stop", 0, new(bool)); err != nil {
+		t.Fatal(err)
+	}
+	third, err := start()
+	if err != nil {
+		t.Error(err)
+	}
+	first.Close()
+
+	//Disconnecting releases the broker as well, once it notices
+	third.Close()
+	for i := 0; ; i++ {
+		client, err := start()
+		client.Close()
+		if err == nil {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("the broker wasn't released after its controller disconnected: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestDistributedKill checks that 'k' writes the final world, then shuts down the broker.
+func TestDistributedKill(t *testing.T) {
+	broker, stop := startCluster(t, 2, nil)
+	defer stop()
+	p := gol.Params{Turns: 1000000000, Threads: 1, ImageWidth: 64, ImageHeight: 64, Broker: broker}
+	events := make(chan gol.Event)
+	keyPresses := make(chan rune, 1)
+	go gol.Run(p, events, keyPresses)
+	keyPresses <- 'k'
+	var final gol.FinalTurnComplete
+	for event := range events {
+		if e, ok := event.(gol.FinalTurnComplete); ok {
+			final = e
+		}
+	}
+	assertEqualBoard(t, final.Alive, runFinal(gol.Params{Turns: final.CompletedTurns, Threads: 1, ImageWidth: 64, ImageHeight: 64}), p)
+	if client, err := rpc.Dial("tcp", broker); err == nil {
+		client.Close()
+		t.Error("the broker was still accepting connections after 'k'")
+	}
+}
+
+// startCluster starts a broker and the given number of workers on loopback, and returns the address of the
+// broker and a function that stops it accepting new connections. If transferred isn't nil, every byte sent
+// or received by a worker is added to it.
+func startCluster(t testing.TB, workers int, transferred *int64) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go gol.ServeBroker(l)
+	for i := 0; i < workers; i++ {
+		workerListener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if transferred != nil {
+			workerListener = countingListener{workerListener, transferred}
+		}
+		registered := &registeredListener{Listener: workerListener, accepting: make(chan bool)}
+		go func() {
+			if err := gol.ServeWorker(registered, l.Addr().String()); err != nil {
+				t.Error(err)
+				close(registered.accepting)
+			}
+		}()
+		<-registered.accepting
+	}
+	return l.Addr().String(), func() { l.Close() }
+}
+
+// startWorkerProcess runs the worker command at path, and waits for it to register with the broker.
+func startWorkerProcess(t *testing.T, path, broker string) *os.Process {
+	cmd := exec.Command(path, "-listen", "127.0.0.1:0", "-broker", broker)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	lines := bufio.NewScanner(stdout)
+	for lines.Scan() && !strings.HasPrefix(lines.Text(), "Registered") {
+	}
+	go io.Copy(ioutil.Discard, stdout)
+	return cmd.Process
+}
+
+// registeredListener is a worker's listener, which signals once the worker has registered with its broker
+// and starts accepting connections.
+type registeredListener struct {
+	net.Listener
+	accepting chan bool
+	once      sync.Once
+}
+
+func (l *registeredListener) Accept() (net.Conn, error) {
+	l.once.Do(func() { close(l.accepting) })
+	return l.Listener.Accept()
+}
+
+// countingListener accepts connections that add the number of bytes sent and received over them to transferred.
+type countingListener struct {
+	net.Listener
+	transferred *int64
+}
+
+func (l countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	return countingConn{conn, l.transferred}, err
+}
+
+type countingConn struct {
+	net.Conn
+	transferred *int64
+}
+
+func (c countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(c.transferred, int64(n))
+	return n, err
+}
+
+func (c countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(c.transferred, int64(n))
+	return n, err
+}
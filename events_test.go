@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestCellFlippedEvents checks that a run with CellFlippedEvents set sends a CellFlipped event for every cell
+// of the CellsFlipped events of the same run without it, on the same turns, and no CellsFlipped events.
+func TestCellFlippedEvents(t *testing.T) {
+	tests := []struct {
+		name string
+		p    gol.Params
+	}{
+		{"strips", gol.Params{Turns: 100, Threads: 4, ImageWidth: 64, ImageHeight: 64}},
+		{"unbounded", gol.Params{Turns: 100, Threads: 4, ImageWidth: 64, ImageHeight: 64, Unbounded: true}},
+		{"hashlife", gol.Params{Turns: 1000, ImageWidth: 64, ImageHeight: 64, Engine: gol.HashLife}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := test.p
+			flipped := flipsByTurn(t, p)
+			p.CellFlippedEvents = true
+			compatible := flipsByTurn(t, p)
+			if len(flipped) == 0 {
+				t.Fatal("expected cells to flip")
+			}
+			if !reflect.DeepEqual(flipped, compatible) {
+				t.Errorf("the CellFlipped events differ from the CellsFlipped events")
+			}
+		})
+	}
+}
+
+// flipsByTurn runs p and returns the cells flipped on each turn, in order, failing if p.CellFlippedEvents
+// isn't followed.
+func flipsByTurn(t *testing.T, p gol.Params) map[int][]util.Cell {
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	flipped := make(map[int][]util.Cell)
+	for event := range events {
+		switch e := event.(type) {
+		case gol.CellFlipped:
+			if !p.CellFlippedEvents {
+				t.Fatalf("CellFlipped event on turn %d", e.CompletedTurns)
+			}
+			flipped[e.CompletedTurns] = append(flipped[e.CompletedTurns], e.Cell)
+		case gol.CellsFlipped:
+			if p.CellFlippedEvents {
+				t.Fatalf("CellsFlipped event on turn %d", e.CompletedTurns)
+			}
+			flipped[e.CompletedTurns] = append(flipped[e.CompletedTurns], e.Cells...)
+		}
+	}
+	for _, cells := range flipped {
+		sort.Slice(cells, func(i, j int) bool {
+			return cells[i].Y < cells[j].Y || cells[i].Y == cells[j].Y && cells[i].X < cells[j].X
+		})
+	}
+	return flipped
+}
+
+// TestEventsJSON writes every event of a run of the glider on a 16x16 torus, which finds a cycle, and of a
+// Generations run as JSON Lines, and checks that they are read back the same, skipping any other output in
+// between.
+func TestEventsJSON(t *testing.T) {
+	tests := []gol.Params{
+		{Turns: 100, Threads: 4, ImageWidth: 16, ImageHeight: 16},
+		{Turns: 100, Threads: 4, ImageWidth: 16, ImageHeight: 16, Rule: "B2/S345/C4", CellFlippedEvents: true},
+	}
+	for _, p := range tests {
+		events := make(chan gol.Event)
+		go gol.Run(p, events, nil)
+		var sent []gol.Event
+		var buf bytes.Buffer
+		encoder := gol.NewEventEncoder(&buf)
+		for event := range events {
+			sent = append(sent, event)
+			if err := encoder.Encode(event); err != nil {
+				t.Fatal(err)
+			}
+			buf.WriteString("File 16x16x100 output done!\n")
+		}
+
+		read := make(chan gol.Event)
+		errs := make(chan error, 1)
+		go func() { errs <- gol.ReadEvents(&buf, read) }()
+		var received []gol.Event
+		for event := range read {
+			received = append(received, event)
+		}
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(received, sent) {
+			t.Errorf("%v: the %d events read back differ from the %d events written", p.Rule, len(received), len(sent))
+		}
+	}
+
+	decoder := gol.NewEventDecoder(strings.NewReader(`{"Type":"Unknown","CompletedTurns":1}`))
+	if _, err := decoder.Decode(); err == nil {
+		t.Error("expected an error reading an unknown type of event")
+	}
+}
+
+// TestRecording writes the events of a Generations run as JSON Lines, and checks that every frame of its
+// recording is the world after that turn, stepping forward and then back to the start, and seeking.
+func TestRecording(t *testing.T) {
+	p := gol.Params{Turns: 30, Threads: 4, ImageWidth: 16, ImageHeight: 16, Rule: "B2/S345/C4"}
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	var buf bytes.Buffer
+	encoder := gol.NewEventEncoder(&buf)
+	for event := range events {
+		if err := encoder.Encode(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := gol.ReadRecording(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Frames() != p.Turns+1 {
+		t.Fatalf("expected %d frames, got %d", p.Turns+1, r.Frames())
+	}
+
+	states := make(map[util.Cell]uint8)
+	var frames []map[util.Cell]uint8
+	for i := 0; i < r.Frames(); i++ {
+		for _, event := range r.Frame(i) {
+			applyCells(states, event)
+		}
+		if r.Turn(i) != i {
+			t.Fatalf("expected frame %d to be turn %d, got %d", i, i, r.Turn(i))
+		}
+		if i%10 == 0 {
+			expected := p
+			expected.Turns = i
+			assertEqualBoard(t, aliveIn(states), runFinal(expected), expected)
+		}
+		frame := make(map[util.Cell]uint8)
+		for cell, state := range states {
+			frame[cell] = state
+		}
+		frames = append(frames, frame)
+	}
+	for i := r.Frames() - 1; i > 0; i-- {
+		for _, event := range r.Back(i) {
+			applyCells(states, event)
+		}
+		if !reflect.DeepEqual(states, frames[i-1]) {
+			t.Fatalf("stepping back from frame %d didn't give frame %d", i, i-1)
+		}
+	}
+
+	if i := r.Seek(15); i != 15 {
+		t.Errorf("expected turn 15 to be frame 15, got %d", i)
+	}
+	if i := r.Seek(100); i != p.Turns {
+		t.Errorf("expected a turn after the recording to seek to its last frame, got %d", i)
+	}
+}
+
+// applyCells applies the cell events of a run to the states of its cells, as a window shows them.
+func applyCells(states map[util.Cell]uint8, event gol.Event) {
+	switch e := event.(type) {
+	case gol.CellFlipped:
+		applyCells(states, gol.CellsFlipped{CompletedTurns: e.CompletedTurns, Cells: []util.Cell{e.Cell}})
+	case gol.CellsFlipped:
+		for _, cell := range e.Cells {
+			if states[cell] == 1 {
+				delete(states, cell)
+			} else {
+				states[cell] = 1
+			}
+		}
+	case gol.CellStateChanged:
+		if e.State == 0 {
+			delete(states, e.Cell)
+		} else {
+			states[e.Cell] = e.State
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestGenerations tests 16x16 and 64x64 images on 1, 10 and 100 turns under Generations rules using 1-8 worker threads.
+// Both the alive cells and the grey levels of dying cells in the output image are checked.
+func TestGenerations(t *testing.T) {
+	rules := map[string]string{
+		"B2/S/C3":    "/2/3",    // Brian's Brain
+		"B2/S345/C4": "345/2/4", // Star Wars
+	}
+	tests := []gol.Params{
+		{ImageWidth: 16, ImageHeight: 16},
+		{ImageWidth: 64, ImageHeight: 64},
+	}
+	for bsc, sbc := range rules {
+		for _, p := range tests {
+			for _, turns := range []int{1, 10, 100} {
+				p.Turns = turns
+				expectedImage := readPgmPixels(t,
+					"check/rules/"+strings.Replace(bsc, "/", "", -1)+fmt.Sprintf("/%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, turns))
+				var expectedAlive []util.Cell
+				for i, grey := range expectedImage {
+					if grey == 255 {
+						expectedAlive = append(expectedAlive, util.Cell{X: i % p.ImageWidth, Y: i / p.ImageWidth})
+					}
+				}
+				for _, rule := range []string{bsc, sbc} {
+					p.Rule = rule
+					for threads := 1; threads <= 8; threads++ {
+						p.Threads = threads
+						testName := fmt.Sprintf("%s/%dx%dx%d-%d", rule, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+						t.Run(testName, func(t *testing.T) {
+							events := make(chan gol.Event)
+							go gol.Run(p, events, nil)
+							var cells []util.Cell
+							for event := range events {
+								switch e := event.(type) {
+								case gol.FinalTurnComplete:
+									cells = e.Alive
+								}
+							}
+							assertEqualBoard(t, cells, expectedAlive, p)
+
+							image := readPgmPixels(t, fmt.Sprintf("out/%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, turns))
+							if !bytes.Equal(image, expectedImage) {
+								t.Error("output image grey levels don't match the expected dying cells")
+							}
+						})
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestGenerationsEvents checks that applying CellStateChanged events reproduces the final output image.
+func TestGenerationsEvents(t *testing.T) {
+	p := gol.Params{Turns: 10, Threads: 4, ImageWidth: 16, ImageHeight: 16, Rule: "B2/S345/C4"}
+	states := make([]uint8, p.ImageWidth*p.ImageHeight)
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	for event := range events {
+		switch e := event.(type) {
+		case gol.CellStateChanged:
+			states[e.Cell.Y*p.ImageWidth+e.Cell.X] = e.State
+		}
+	}
+
+	expected := readPgmPixels(t, "check/rules/B2S345C4/16x16x10.pgm")
+	greys := map[uint8]uint8{0: 0, 1: 255, 2: 170, 3: 85}
+	for i, state := range states {
+		if greys[state] != expected[i] {
+			t.Fatalf("cell (%d, %d) has state %d, expected grey level %d", i%p.ImageWidth, i/p.ImageWidth, state, expected[i])
+		}
+	}
+}
+
+// readPgmPixels returns the pixel data of a binary pgm image with a maxval of 255.
+func readPgmPixels(t *testing.T, path string) []byte {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//The header is four whitespace separated fields, the last followed by a single whitespace byte
+	fields := 0
+	for i := 0; i < len(data); i++ {
+		if data[i] == ' ' || data[i] == '\n' {
+			fields++
+			if fields == 4 {
+				return data[i+1:]
+			}
+		}
+	}
+	t.Fatalf("%s is not a pgm image", path)
+	return nil
+}
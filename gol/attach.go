@@ -0,0 +1,103 @@
+package gol
+
+import (
+	"context"
+	"fmt"
+	"net/rpc"
+)
+
+// Attach connects to the server at address (see Serve) as its controller, and returns a Controller for its
+// run and the params it was started with, such as the size of the window to show it in.
+//
+// The events of the run are sent down events, starting with a CellsFlipped event with every alive cell at the
+// last completed turn, or CellFlipped events if the run has Params.CellFlippedEvents set. Quit detaches from the server, which carries on with the run, and Kill shuts the
+// server down once the final world has been written. events is closed once the controller has detached
+// or the run has finished. The controller also detaches once ctx is cancelled.
+func Attach(ctx context.Context, address string, events chan<- Event) (*Controller, Params, error) {
+	var p Params
+	client, err := rpc.Dial("tcp", address)
+	if err != nil {
+		return nil, p, fmt.Errorf("server: %v", err)
+	}
+	if err := client.Call("Server.Attach", 0, &p); err != nil {
+		client.Close()
+		return nil, p, fmt.Errorf("server: %v", err)
+	}
+	commands := make(chan command)
+	c := newController(commands, p)
+	go func() {
+		err := forward(client, events, commands)
+		close(events)
+		c.finish(err)
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Quit()
+		case <-c.done:
+		}
+	}()
+	return c, p, nil
+}
+
+// forward sends the events of the run on the server down events, and carries out the commands of its
+// Controller on the server, until it detaches or the run finishes.
+func forward(client *rpc.Client, events chan<- Event, commands <-chan command) error {
+	defer client.Close()
+
+	detached := make(chan bool)
+	polled := make(chan error, 1)
+	go func() {
+		for {
+			var reply PollReply
+			if err := client.Call("Server.Poll", 0, &reply); err != nil {
+				polled <- fmt.Errorf("server: %v", err)
+				return
+			}
+			for _, event := range reply.Events {
+				select {
+				case events <- event:
+				case <-detached:
+					polled <- nil
+					return
+				}
+			}
+			if reply.Done {
+				polled <- nil
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case err := <-polled:
+			return err
+		case cmd := <-commands:
+			if cmd.op == opQuit {
+				close(detached)
+				err := client.Call("Server.Detach", 0, new(bool))
+				cmd.reply <- result{}
+				<-polled
+				return err
+			}
+			var reply CommandReply
+			err := client.Call("Server.Command", CommandRequest{Op: int(cmd.op), N: cmd.n, Path: cmd.path}, &reply)
+			cmd.reply <- result{turn: reply.Turn, alive: reply.Alive, err: remoteError(err)}
+		}
+	}
+}
+
+// remoteError returns the error a server replied to a command with, as the error the Controller of the
+// run returned if it is one of the errors of Controller.
+func remoteError(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, known := range []error{ErrPaused, ErrNotPaused, ErrNoHistory, ErrFinished} {
+		if err.Error() == known.Error() {
+			return known
+		}
+	}
+	return fmt.Errorf("server: %v", err)
+}
@@ -0,0 +1,254 @@
+package gol
+
+import (
+	"math/bits"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// wordSize is the number of cells packed into each board word.
+const wordSize = 64
+
+// Cell states. Under Generations rules, a cell that dies passes through the refractory states
+// 2, 3, ..., states-1 before it is dead (state 0) again.
+const (
+	dead  uint8 = 0
+	alive uint8 = 1
+)
+
+// board is a bit-packed world. Each row is stored as stride uint64 words holding 64 cells each,
+// with cell x of a row at bit x%64 of word x/64. Bits beyond the width of the board are always 0.
+// Boards for Generations rules also track dying cells, in a second bit plane laid out the same way
+// plus a byte per cell holding the refractory state of the dying ones.
+type board struct {
+	width, height int
+	stride        int
+	words         []uint64 // alive cells
+	dying         []uint64 // cells in a refractory state, nil for two-state rules
+	decay         []uint8  // the state of each dying cell, only meaningful where dying is set
+}
+
+// newBoard returns an empty (all dead) board of the given size, for a rule with the given number of states.
+func newBoard(width, height, states int) *board {
+	stride := (width + wordSize - 1) / wordSize
+	b := &board{
+		width:  width,
+		height: height,
+		stride: stride,
+		words:  make([]uint64, stride*height),
+	}
+	if states > 2 {
+		b.dying = make([]uint64, stride*height)
+		b.decay = make([]uint8, width*height)
+	}
+	return b
+}
+
+// row returns the words that make up row y. The slice aliases the board.
+func (b *board) row(y int) []uint64 {
+	return b.words[y*b.stride : (y+1)*b.stride]
+}
+
+// dyingRow returns the dying bit plane of row y, or nil for a two-state board.
+func (b *board) dyingRow(y int) []uint64 {
+	if b.dying == nil {
+		return nil
+	}
+	return b.dying[y*b.stride : (y+1)*b.stride]
+}
+
+// copyRows copies n rows of src, starting at row srcY, into b starting at row y.
+func (b *board) copyRows(y int, src *board, srcY, n int) {
+	copy(b.words[y*b.stride:(y+n)*b.stride], src.words[srcY*src.stride:])
+	if b.dying != nil {
+		copy(b.dying[y*b.stride:(y+n)*b.stride], src.dying[srcY*src.stride:])
+		copy(b.decay[y*b.width:(y+n)*b.width], src.decay[srcY*src.width:])
+	}
+}
+
+// get reports whether the cell at (x, y) is alive.
+func (b *board) get(x, y int) bool {
+	return b.words[y*b.stride+x/wordSize]&(1<<uint(x%wordSize)) != 0
+}
+
+// set makes the cell at (x, y) alive or dead.
+func (b *board) set(x, y int, alive bool) {
+	if alive {
+		b.words[y*b.stride+x/wordSize] |= 1 << uint(x%wordSize)
+	} else {
+		b.words[y*b.stride+x/wordSize] &^= 1 << uint(x%wordSize)
+	}
+}
+
+// state returns the state of the cell at (x, y).
+func (b *board) state(x, y int) uint8 {
+	if b.dying != nil && b.dying[y*b.stride+x/wordSize]&(1<<uint(x%wordSize)) != 0 {
+		return b.decay[y*b.width+x]
+	}
+	if b.get(x, y) {
+		return alive
+	}
+	return dead
+}
+
+// setState sets the state of the cell at (x, y). States above alive are only valid for Generations boards.
+func (b *board) setState(x, y int, state uint8) {
+	b.set(x, y, state == alive)
+	if b.dying == nil {
+		return
+	}
+	if state > alive {
+		b.dying[y*b.stride+x/wordSize] |= 1 << uint(x%wordSize)
+		b.decay[y*b.width+x] = state
+	} else {
+		b.dying[y*b.stride+x/wordSize] &^= 1 << uint(x%wordSize)
+	}
+}
+
+// aliveCells returns a list of all alive cells in the board, in row-major order.
+func (b *board) aliveCells() []util.Cell {
+	cells := make([]util.Cell, 0)
+	for y := 0; y < b.height; y++ {
+		for i, word := range b.row(y) {
+			for word != 0 {
+				x := i*wordSize + bits.TrailingZeros64(word)
+				cells = append(cells, util.Cell{X: x, Y: y})
+				word &= word - 1
+			}
+		}
+	}
+	return cells
+}
+
+// aliveCount returns the number of alive cells in the board.
+func (b *board) aliveCount() int {
+	count := 0
+	for _, word := range b.words {
+		count += bits.OnesCount64(word)
+	}
+	return count
+}
+
+// equal reports whether b holds the same cells in the same states as other.
+func (b *board) equal(other *board) bool {
+	if b.width != other.width || b.height != other.height {
+		return false
+	}
+	for i, word := range b.words {
+		if word != other.words[i] {
+			return false
+		}
+	}
+	for i, word := range b.dying {
+		if word != other.dying[i] {
+			return false
+		}
+		//Only the decay of the dying cells in the word means anything
+		for ; word != 0; word &= word - 1 {
+			x := i%b.stride*wordSize + bits.TrailingZeros64(word)
+			if b.decay[i/b.stride*b.width+x] != other.decay[i/b.stride*b.width+x] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// lastWordMask returns the mask of bits in the final word of a row that lie inside the board.
+func lastWordMask(width int) uint64 {
+	tail := uint(width - (width-1)/wordSize*wordSize)
+	if tail == wordSize {
+		return ^uint64(0)
+	}
+	return 1<<tail - 1
+}
+
+// paddedRow is a row of cells together with the cells just beyond its west and east edges (0 or 1),
+// which depend on the topology of the world.
+type paddedRow struct {
+	words      []uint64
+	west, east uint64
+}
+
+// neighbourWords returns word i of a row shifted so that bit x holds the cell to the west (x-1)
+// and to the east (x+1) of cell x respectively.
+func neighbourWords(row paddedRow, i, width int) (west, east uint64) {
+	last := len(row.words) - 1
+	lastBit := uint((width - 1) % wordSize)
+
+	west = row.words[i] << 1
+	if i > 0 {
+		west |= row.words[i-1] >> (wordSize - 1)
+	} else {
+		west |= row.west
+	}
+
+	east = row.words[i] >> 1
+	if i < last {
+		east |= row.words[i+1] << (wordSize - 1)
+	} else {
+		east |= row.east << lastBit
+	}
+	return west, east
+}
+
+// fullAdd adds three bit planes, returning the sum and carry planes.
+func fullAdd(a, b, c uint64) (sum, carry uint64) {
+	half := a ^ b
+	return half ^ c, a&b | half&c
+}
+
+// countWords adds the eight neighbour planes of a word, returning the neighbour count of every
+// cell as four bit planes of weight 1, 2, 4 and 8.
+func countWords(nw, n, ne, w, e, sw, s, se uint64) (ones, twos, fours, eights uint64) {
+	sumA, carryA := fullAdd(nw, n, ne)
+	sumB, carryB := fullAdd(w, e, sw)
+	sumC, carryC := s^se, s&se
+	ones, carryD := fullAdd(sumA, sumB, sumC)
+	partial, carryE := fullAdd(carryA, carryB, carryC)
+	twos, carryF := partial^carryD, partial&carryD
+	fours, eights = carryE^carryF, carryE&carryF
+	return ones, twos, fours, eights
+}
+
+// nextRow calculates which cells of row are alive next turn under rule r from the rows above and
+// below it, and writes them into dst. dying is the dying bit plane of row, or nil under two-state rules.
+func nextRow(dst []uint64, above, row, below paddedRow, dying []uint64, width int, r rule) {
+	for i := range row.words {
+		nw, ne := neighbourWords(above, i, width)
+		w, e := neighbourWords(row, i, width)
+		sw, se := neighbourWords(below, i, width)
+		ones, twos, fours, eights := countWords(nw, above.words[i], ne, w, e, sw, below.words[i], se)
+		var refractory uint64
+		if dying != nil {
+			refractory = dying[i]
+		}
+		dst[i] = r.nextWord(row.words[i], refractory, ones, twos, fours, eights)
+	}
+	dst[len(dst)-1] &= lastWordMask(width)
+}
+
+// nextDecayRow moves the dying cells of row y of b one state further into next, once the alive cells
+// of next have been calculated: alive cells that didn't survive start dying and dying cells in their
+// last state become dead.
+func (b *board) nextDecayRow(next *board, y, states int) {
+	row, newRow := b.row(y), next.row(y)
+	dying, newDying := b.dyingRow(y), next.dyingRow(y)
+	for i := range row {
+		newDying[i] = row[i] &^ newRow[i]
+		for word := newDying[i]; word != 0; word &= word - 1 {
+			x := i*wordSize + bits.TrailingZeros64(word)
+			next.decay[y*b.width+x] = alive + 1
+		}
+
+		for word := dying[i]; word != 0; word &= word - 1 {
+			bit := bits.TrailingZeros64(word)
+			x := i*wordSize + bit
+			state := int(b.decay[y*b.width+x]) + 1
+			if state < states {
+				newDying[i] |= 1 << uint(bit)
+				next.decay[y*b.width+x] = uint8(state)
+			}
+		}
+	}
+}
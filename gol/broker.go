@@ -0,0 +1,411 @@
+package gol
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// heartbeatInterval is how often the broker checks that each worker is still there.
+	heartbeatInterval = time.Second
+	// heartbeatTimeout is how long a worker has to answer a heartbeat before the broker gives up on it.
+	heartbeatTimeout = 5 * time.Second
+	// gatherInterval is the most turns the copy of the world the broker recovers from can fall behind by,
+	// while the controller doesn't ask for the changed cells, before the broker gathers it from the workers.
+	gatherInterval = 100
+)
+
+// member is a worker that has registered with the broker.
+type member struct {
+	address string
+	client  *rpc.Client
+	failed  int32 // set atomically, once the worker has stopped answering
+}
+
+// fail gives up on the worker, which makes any call to it that hasn't returned yet fail too.
+func (m *member) fail() {
+	if atomic.CompareAndSwapInt32(&m.failed, 0, 1) {
+		m.client.Close()
+		fmt.Println("Worker", m.address, "failed")
+	}
+}
+
+// ping reports whether the worker answers within heartbeatTimeout, and gives up on it if it doesn't.
+func (m *member) ping() bool {
+	if atomic.LoadInt32(&m.failed) != 0 {
+		return false
+	}
+	call := m.client.Go("Worker.Ping", 0, new(bool), nil)
+	timeout := time.NewTimer(heartbeatTimeout)
+	defer timeout.Stop()
+	select {
+	case <-call.Done:
+		if call.Error == nil {
+			return true
+		}
+	case <-timeout.C:
+	}
+	m.fail()
+	return false
+}
+
+// heartbeat pings the worker every heartbeatInterval until it fails.
+func (m *member) heartbeat() {
+	for m.ping() {
+		time.Sleep(heartbeatInterval)
+	}
+}
+
+// broker runs the game of life for a controller on the workers that have registered with it. It splits
+// the world into a strip for each worker, then only starts each turn once every worker has finished the
+// last one: workers exchange halo rows between themselves, and the world is only gathered from them
+// when the controller asks for it.
+//
+// Only one controller can run a world at a time: it owns the broker from Start until it calls Stop or
+// disconnects, and other controllers are turned away until then, rather than re-splitting its world.
+//
+// The broker also keeps a copy of the world, which the cells that change each turn keep up to date while
+// the controller asks for them, and which is gathered from the workers every gatherInterval turns while it
+// doesn't. If a worker fails, the copy is split between the workers that are left, and any turns it is
+// behind by are run again, so that they carry on from the last completed turn.
+type broker struct {
+	mu       sync.Mutex
+	listener net.Listener
+	members  []*member // the first running members each have a strip of the world
+	owner    *session  // the connection of the controller running a world, nil if there isn't one
+
+	running   int   // the number of workers with a strip of the world, 0 before the first run
+	lengths   []int // the strip of worker i is rows lengths[i] up to lengths[i+1]
+	epoch     int   // the number of times a world has been split, which tags halos with the split they belong to
+	rule      rule
+	topology  Topology
+	turn      int    // the number of turns completed
+	world     *board // the world at worldTurn
+	worldTurn int
+}
+
+// session is a connection from a controller or worker, which serves the RPC methods of the broker.
+// It tells the broker which controller is calling.
+type session struct {
+	b *broker
+}
+
+// ServeBroker accepts connections from controllers and workers on l, until l is closed.
+func ServeBroker(l net.Listener) error {
+	b := &broker{listener: l}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return nil
+		}
+		s := &session{b}
+		server := rpc.NewServer()
+		if err := server.RegisterName("Broker", s); err != nil {
+			conn.Close()
+			return err
+		}
+		go func() {
+			server.ServeConn(conn)
+			s.Stop(0, new(bool))
+		}()
+	}
+}
+
+// Register is called by a worker listening on address, which the broker connects back to.
+// It replies with the number of registered workers.
+func (s *session) Register(address string, workers *int) error {
+	b := s.b
+	client, err := rpc.Dial("tcp", address)
+	if err != nil {
+		return err
+	}
+	m := &member{address: address, client: client}
+	go m.heartbeat()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.members = append(b.members, m)
+	*workers = len(b.members)
+	fmt.Println("Worker", address, "registered")
+	return nil
+}
+
+// Start splits the world in req between the workers, and replies with how many of them it is split between.
+// The controller owns the broker until it calls Stop or disconnects.
+func (s *session) Start(req StartRequest, workers *int) error {
+	b := s.b
+	r, err := parseRule(req.Rule)
+	if err != nil {
+		return err
+	}
+	if !req.World.valid(r.states) || req.Turn < 0 {
+		return fmt.Errorf("malformed %dx%d world", req.World.Width, req.World.Height)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.removeFailed()
+	if len(b.members) == 0 {
+		return errors.New("no workers have registered with the broker")
+	}
+	if b.owner != nil && b.owner != s {
+		return errors.New("the broker is already running a world for another controller")
+	}
+
+	b.running = 0
+	b.rule, b.topology = r, req.Topology
+	b.world, b.worldTurn, b.turn = req.World.board(), req.Turn, req.Turn
+	if err := b.split(); err != nil {
+		if err = b.recover(err); err != nil {
+			return err
+		}
+	}
+	b.owner = s
+	*workers = b.running
+	return nil
+}
+
+// Stop releases the broker for other controllers, if this controller owns it.
+func (s *session) Stop(_ int, _ *bool) error {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	if s.b.owner == s {
+		s.b.owner = nil
+	}
+	return nil
+}
+
+// Shutdown shuts down every worker, then stops the broker accepting connections, so that ServeBroker
+// returns. Only the controller that owns the broker can shut it down.
+func (s *session) Shutdown(_ int, _ *bool) error {
+	b := s.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := s.check(); err != nil {
+		return err
+	}
+	done := make(chan *rpc.Call, len(b.members))
+	for _, m := range b.members {
+		m.client.Go("Worker.Shutdown", 0, new(bool), done)
+	}
+	for range b.members {
+		<-done
+	}
+	fmt.Println("Shutting down")
+	return b.listener.Close()
+}
+
+// check returns an error unless the controller of s owns the broker.
+func (s *session) check() error {
+	if s.b.owner != s {
+		return errors.New("the broker hasn't been started by this controller")
+	}
+	return nil
+}
+
+// removeFailed forgets the workers that have failed, and reports how many there were.
+func (b *broker) removeFailed() int {
+	var members []*member
+	for _, m := range b.members {
+		if atomic.LoadInt32(&m.failed) == 0 {
+			members = append(members, m)
+		}
+	}
+	removed := len(b.members) - len(members)
+	b.members = members
+	return removed
+}
+
+// split gives every worker a strip of the copy of the world, which it progresses to the current turn.
+func (b *broker) split() error {
+	world := b.world
+	b.epoch++
+	b.lengths = sectionLengths(world.height, len(b.members))
+	b.running = len(b.lengths) - 1
+	calls := make([]*rpc.Call, b.running)
+	done := make(chan *rpc.Call, b.running)
+	for i := range calls {
+		startY, endY := b.lengths[i], b.lengths[i+1]
+		setup := SetupRequest{
+			Rule:        b.rule.String(),
+			Topology:    b.topology,
+			Epoch:       b.epoch,
+			StartY:      startY,
+			WorldHeight: world.height,
+			Strip:       world.rows(startY, endY-startY),
+			Up:          b.members[(i-1+b.running)%b.running].address,
+			Down:        b.members[(i+1)%b.running].address,
+		}
+		calls[i] = b.members[i].client.Go("Worker.Setup", setup, new(bool), done)
+	}
+	if err := b.wait(calls, done); err != nil {
+		return err
+	}
+	for turn := b.worldTurn; turn < b.turn; turn++ {
+		if _, err := b.call("Worker.Step", StepRequest{Turn: turn}, func() interface{} { return new(StepReply) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recover splits the world between the workers that are left after a call to them fails with err.
+// It returns err if no worker has failed, as the world can't be recovered from other errors.
+func (b *broker) recover(err error) error {
+	for {
+		//A worker that was killed fails calls straight away, but one that hangs is only found by its heartbeat
+		for _, m := range b.members[:b.running] {
+			m.ping()
+		}
+		if b.removeFailed() == 0 {
+			return err
+		}
+		if len(b.members) == 0 {
+			return errors.New("every worker has failed")
+		}
+		fmt.Println("Recovering the world on", len(b.members), "workers from turn", b.worldTurn)
+		if err = b.split(); err == nil {
+			return nil
+		}
+	}
+}
+
+// wait waits for calls to every running worker, which all complete on done, and returns the first error.
+// Calls complete in any order, and as soon as one fails the turns of the other workers are aborted, as
+// they may be waiting for halos from the failed one.
+func (b *broker) wait(calls []*rpc.Call, done chan *rpc.Call) error {
+	var err error
+	for range calls {
+		call := <-done
+		if call.Error == nil || err != nil {
+			continue
+		}
+		for i, c := range calls {
+			if c == call {
+				err = fmt.Errorf("worker %s: %v", b.members[i].address, call.Error)
+			}
+		}
+		for _, m := range b.members[:b.running] {
+			m.client.Go("Worker.Abort", b.epoch, new(bool), nil)
+		}
+	}
+	return err
+}
+
+// call calls a method of every running worker at once, with a reply from newReply, and waits for them all.
+func (b *broker) call(method string, args interface{}, newReply func() interface{}) ([]interface{}, error) {
+	if b.running == 0 {
+		return nil, errors.New("the broker hasn't been started")
+	}
+	calls := make([]*rpc.Call, b.running)
+	done := make(chan *rpc.Call, b.running)
+	replies := make([]interface{}, b.running)
+	for i := range calls {
+		replies[i] = newReply()
+		calls[i] = b.members[i].client.Go(method, args, replies[i], done)
+	}
+	return replies, b.wait(calls, done)
+}
+
+// callOrRecover calls a method of every running worker, recovering from any that fail and calling it again.
+func (b *broker) callOrRecover(method string, args interface{}, newReply func() interface{}) ([]interface{}, error) {
+	for {
+		replies, err := b.call(method, args, newReply)
+		if err == nil || b.running == 0 {
+			return replies, err
+		}
+		if err = b.recover(err); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Step has every worker progress its strip by one turn, and replies with the cells that changed if they
+// are requested.
+func (s *session) Step(req StepRequest, reply *StepReply) error {
+	b := s.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := s.check(); err != nil {
+		return err
+	}
+	if req.Turn != b.turn {
+		return fmt.Errorf("expected turn %d, not turn %d", b.turn, req.Turn)
+	}
+	replies, err := b.callOrRecover("Worker.Step", req, func() interface{} { return new(StepReply) })
+	if err != nil {
+		return err
+	}
+	for _, r := range replies {
+		strip := r.(*StepReply)
+		reply.Flipped = append(reply.Flipped, strip.Flipped...)
+		reply.Changed = append(reply.Changed, strip.Changed...)
+		reply.States = append(reply.States, strip.States...)
+	}
+	reply.Workers = b.running
+
+	//The copy of the world can only be kept up to date while the changed cells are requested
+	if req.Flipped && b.worldTurn == b.turn {
+		b.world.apply(*reply)
+		b.worldTurn++
+	}
+	b.turn++
+	if b.turn-b.worldTurn >= gatherInterval {
+		return b.gather()
+	}
+	return nil
+}
+
+// AliveCount replies with the number of alive cells in the world.
+func (s *session) AliveCount(_ int, count *int) error {
+	b := s.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := s.check(); err != nil {
+		return err
+	}
+	replies, err := b.callOrRecover("Worker.AliveCount", 0, func() interface{} { return new(int) })
+	if err != nil {
+		return err
+	}
+	for _, r := range replies {
+		*count += *r.(*int)
+	}
+	return nil
+}
+
+// Snapshot gathers the strips of the world from the workers, and replies with it.
+func (s *session) Snapshot(_ int, world *BoardRows) error {
+	b := s.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := s.check(); err != nil {
+		return err
+	}
+	if err := b.gather(); err != nil {
+		return err
+	}
+	*world = b.world.rows(0, b.world.height)
+	return nil
+}
+
+// gather brings the copy of the world up to date with the strips of the workers.
+func (b *broker) gather() error {
+	replies, err := b.callOrRecover("Worker.Snapshot", 0, func() interface{} { return new(BoardRows) })
+	if err != nil {
+		return err
+	}
+	gathered := newBoard(b.world.width, b.world.height, b.rule.states)
+	for i, r := range replies {
+		strip := r.(*BoardRows)
+		if !strip.valid(b.rule.states) || strip.Width != gathered.width || strip.Height != b.lengths[i+1]-b.lengths[i] {
+			return fmt.Errorf("worker %s: malformed strip", b.members[i].address)
+		}
+		gathered.copyRows(b.lengths[i], strip.board(), 0, strip.Height)
+	}
+	b.world, b.worldTurn = gathered, b.turn
+	return nil
+}
@@ -0,0 +1,300 @@
+package gol
+
+import (
+	"reflect"
+	"sync"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// defaultBusBuffer is the most events kept for a DropOldest subscriber if Subscription.Buffer is 0.
+const defaultBusBuffer = 1000
+
+// Policy is what a Bus does with the events of a run that a subscriber isn't ready for.
+type Policy int
+
+const (
+	// Block holds up the run until the subscriber takes each event, as a single events channel does.
+	Block Policy = iota
+	// DropOldest keeps the latest Subscription.Buffer events, and drops the oldest once there are more.
+	DropOldest
+	// Coalesce merges the cell events and TurnComplete events that the subscriber falls behind on into a
+	// CellsFlipped event, a CellStateChanged event for every cell that changed state and the latest
+	// TurnComplete, so that a window skips frames instead of holding up the run. Other events are all kept.
+	Coalesce
+)
+
+// Subscription is how the events of a run are sent to a subscriber of a Bus.
+type Subscription struct {
+	// Types are the types of event that are sent, each given as an event of that type such as
+	// TurnComplete{}. Every event is sent if there are none.
+	Types []Event
+
+	// Policy is what is done with the events that the subscriber isn't ready for.
+	Policy Policy
+
+	// Buffer is the most events kept by DropOldest, or defaultBusBuffer if it is 0.
+	Buffer int
+}
+
+// Bus sends the events of a run to any number of subscribers, such as a window, a logger and network
+// clients, so that the run isn't held up by any of them unless it subscribed with Block.
+type Bus struct {
+	mu          sync.Mutex
+	subscribers []*subscriber // replaced rather than changed, so that it can be sent to without the lock
+	closed      bool          // set once the run has sent its last event
+}
+
+// NewBus starts sending the events of a run, received from events, to the subscribers of the bus. The
+// channel of every subscriber is closed once events is closed and it has been sent the events before.
+func NewBus(events <-chan Event) *Bus {
+	b := new(Bus)
+	go b.publish(events)
+	return b
+}
+
+// Subscribe sends the events of the run from now on down events, as given by s, until the run has finished
+// or events is unsubscribed, and closes it then. A channel can only be subscribed once.
+func (b *Bus) Subscribe(events chan<- Event, s Subscription) {
+	sub := newSubscriber(events, s)
+	go sub.forward()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		sub.finish()
+		return
+	}
+	b.subscribers = append(b.subscribers[:len(b.subscribers):len(b.subscribers)], sub)
+}
+
+// Unsubscribe stops sending events down events, and closes it without sending the events it hasn't taken.
+func (b *Bus) Unsubscribe(events chan<- Event) {
+	b.mu.Lock()
+	var left *subscriber
+	var subscribers []*subscriber
+	for _, sub := range b.subscribers {
+		if sub.events == events {
+			left = sub
+		} else {
+			subscribers = append(subscribers, sub)
+		}
+	}
+	b.subscribers = subscribers
+	b.mu.Unlock()
+	if left != nil {
+		left.leave()
+	}
+}
+
+// publish sends every event of the run to the subscribers that want it, and then finishes them.
+func (b *Bus) publish(events <-chan Event) {
+	for event := range events {
+		b.mu.Lock()
+		subscribers := b.subscribers
+		b.mu.Unlock()
+		for _, sub := range subscribers {
+			if sub.wants(event) {
+				sub.push(event)
+			}
+		}
+	}
+	b.mu.Lock()
+	subscribers := b.subscribers
+	b.subscribers, b.closed = nil, true
+	b.mu.Unlock()
+	for _, sub := range subscribers {
+		sub.finish()
+	}
+}
+
+// subscriber queues the events for a subscriber of a Bus, which a goroutine forwards down its channel.
+type subscriber struct {
+	mu      sync.Mutex
+	changed *sync.Cond // broadcast when events are queued or taken, or the subscriber finishes or leaves
+	events  chan<- Event
+	types   map[reflect.Type]bool
+	policy  Policy
+	buffer  int
+	queue   []Event
+	frame   *frame        // the events merged by Coalesce since the queue, nil if there are none
+	done    bool          // set once the run has sent its last event
+	gone    bool          // set once the subscriber has left
+	left    chan struct{} // closed once the subscriber has left
+}
+
+func newSubscriber(events chan<- Event, s Subscription) *subscriber {
+	sub := &subscriber{events: events, policy: s.Policy, buffer: s.Buffer, left: make(chan struct{})}
+	sub.changed = sync.NewCond(&sub.mu)
+	if sub.buffer == 0 {
+		sub.buffer = defaultBusBuffer
+	}
+	if len(s.Types) > 0 {
+		sub.types = make(map[reflect.Type]bool)
+		for _, event := range s.Types {
+			sub.types[reflect.TypeOf(event)] = true
+		}
+	}
+	return sub
+}
+
+// wants reports whether the subscriber subscribed to the type of event.
+func (s *subscriber) wants(event Event) bool {
+	return s.types == nil || s.types[reflect.TypeOf(event)]
+}
+
+// push queues an event as the policy of the subscriber says, waiting for it to take the event before if
+// the policy is Block.
+func (s *subscriber) push(event Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch s.policy {
+	case Block:
+		for len(s.queue) > 0 && !s.gone {
+			s.changed.Wait()
+		}
+		s.queue = append(s.queue, event)
+	case DropOldest:
+		if len(s.queue) >= s.buffer {
+			s.queue[0] = nil
+			s.queue = s.queue[1:]
+		}
+		s.queue = append(s.queue, event)
+	case Coalesce:
+		switch event.(type) {
+		case CellFlipped, CellsFlipped, CellStateChanged, TurnComplete:
+			if s.frame == nil {
+				s.frame = new(frame)
+			}
+			s.frame.add(event)
+		default:
+			if s.frame != nil {
+				s.queue = append(s.queue, s.frame.events()...)
+				s.frame = nil
+			}
+			s.queue = append(s.queue, event)
+		}
+	}
+	s.changed.Broadcast()
+}
+
+// forward sends the queued events down the channel of the subscriber, and closes it once the run has
+// finished and every event has been sent, or the subscriber has left.
+func (s *subscriber) forward() {
+	defer close(s.events)
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && s.frame == nil && !s.done && !s.gone {
+			s.changed.Wait()
+		}
+		if s.gone || len(s.queue) == 0 && s.frame == nil {
+			s.mu.Unlock()
+			return
+		}
+		if len(s.queue) == 0 {
+			s.queue, s.frame = s.frame.events(), nil
+		}
+		event := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		s.changed.Broadcast()
+		s.mu.Unlock()
+
+		select {
+		case s.events <- event:
+		case <-s.left:
+			return
+		}
+	}
+}
+
+// finish lets the subscriber know that the run has sent its last event.
+func (s *subscriber) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done = true
+	s.changed.Broadcast()
+}
+
+// leave stops the subscriber being sent events.
+func (s *subscriber) leave() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gone = true
+	close(s.left)
+	s.changed.Broadcast()
+}
+
+// frame is the cell events and TurnComplete events that a Coalesce subscriber has fallen behind on, merged
+// together.
+type frame struct {
+	turn     int
+	flipped  []util.Cell        // the cells of the only flip event, until there is another
+	toggled  map[util.Cell]bool // the cells flipped an odd number of times, once there is more than one flip event
+	states   map[util.Cell]uint8
+	complete Event // the latest TurnComplete, nil if there isn't one
+}
+
+// add merges an event into the frame.
+func (f *frame) add(event Event) {
+	switch e := event.(type) {
+	case CellFlipped:
+		f.turn = e.CompletedTurns
+		f.flip([]util.Cell{e.Cell})
+	case CellsFlipped:
+		f.turn = e.CompletedTurns
+		f.flip(e.Cells)
+	case CellStateChanged:
+		f.turn = e.CompletedTurns
+		if f.states == nil {
+			f.states = make(map[util.Cell]uint8)
+		}
+		f.states[e.Cell] = e.State
+	case TurnComplete:
+		f.complete = e
+	}
+}
+
+// flip flips cells, which cancel out if they were flipped before.
+func (f *frame) flip(cells []util.Cell) {
+	if f.flipped == nil && f.toggled == nil {
+		f.flipped = cells
+		return
+	}
+	if f.toggled == nil {
+		f.toggled = make(map[util.Cell]bool)
+		for _, cell := range f.flipped {
+			f.toggled[cell] = true
+		}
+		f.flipped = nil
+	}
+	for _, cell := range cells {
+		if f.toggled[cell] {
+			delete(f.toggled, cell)
+		} else {
+			f.toggled[cell] = true
+		}
+	}
+}
+
+// events returns the events the frame is sent as: the cells flipped, the latest state of every cell that
+// changed state, and the latest TurnComplete.
+func (f *frame) events() []Event {
+	var events []Event
+	flipped := f.flipped
+	if f.toggled != nil {
+		flipped = make([]util.Cell, 0, len(f.toggled))
+		for cell := range f.toggled {
+			flipped = append(flipped, cell)
+		}
+	}
+	if len(flipped) > 0 {
+		events = append(events, CellsFlipped{f.turn, flipped})
+	}
+	for cell, state := range f.states {
+		events = append(events, CellStateChanged{f.turn, cell, state})
+	}
+	if f.complete != nil {
+		events = append(events, f.complete)
+	}
+	return events
+}
@@ -0,0 +1,102 @@
+package gol
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultCheckpointInterval is how often a checkpoint is saved if Params.CheckpointInterval is 0.
+const defaultCheckpointInterval = time.Minute
+
+// checkpoint is the state of a run saved in Params.CheckpointDir, which a later run can resume from.
+// Its fields are exported for gob to encode.
+type checkpoint struct {
+	Params Params // the params of the run, with the rule it was run under
+	Turn   int    // the number of turns completed
+	X, Y   int    // the coordinates of the top left cell of World, which are only nonzero in an unbounded universe
+	World  BoardRows
+}
+
+// ResumeParams returns p with the params that describe the world of the checkpoint at p.Resume: its size,
+// rule, topology, and whether it is unbounded. Run does this itself, but a window needs to know its size.
+func ResumeParams(p Params) (Params, error) {
+	c, err := readCheckpoint(p.Resume)
+	if err != nil {
+		return p, err
+	}
+	return c.resume(p), nil
+}
+
+// resume returns p with the params that describe the world of the checkpoint.
+func (c checkpoint) resume(p Params) Params {
+	p.ImageWidth, p.ImageHeight = c.Params.ImageWidth, c.Params.ImageHeight
+	p.Rule, p.Topology, p.Unbounded = c.Params.Rule, c.Params.Topology, c.Params.Unbounded
+	return p
+}
+
+// readCheckpoint reads the checkpoint at path.
+func readCheckpoint(path string) (checkpoint, error) {
+	var c checkpoint
+	file, err := os.Open(path)
+	if err != nil {
+		return c, fmt.Errorf("checkpoint: %v", err)
+	}
+	defer file.Close()
+	if err := gob.NewDecoder(file).Decode(&c); err != nil {
+		return c, fmt.Errorf("checkpoint %s: %v", path, err)
+	}
+	r, err := parseRule(c.Params.Rule)
+	if err != nil {
+		return c, fmt.Errorf("checkpoint %s: %v", path, err)
+	}
+	//The world of an unbounded universe is the bounding box of its alive cells, which is empty once they have all died
+	valid := c.World.valid(r.states)
+	if c.Params.Unbounded {
+		valid = valid || c.World.Width == 0 && c.World.Height == 0
+	} else {
+		valid = valid && c.World.Width == c.Params.ImageWidth && c.World.Height == c.Params.ImageHeight
+	}
+	if !valid || c.Turn < 0 {
+		return c, fmt.Errorf("checkpoint %s: malformed %dx%d world on turn %d", path, c.World.Width, c.World.Height, c.Turn)
+	}
+	return c, nil
+}
+
+// saveCheckpoint saves world, whose top left cell is (x, y), as the checkpoint for turn in p.CheckpointDir.
+// The checkpoint is written to a temporary file that is then renamed, so it is never seen half written,
+// and the checkpoint it replaces, saved on turn previous, is then removed.
+func saveCheckpoint(p Params, r rule, world *board, x, y, turn, previous int) error {
+	p.Rule = r.String()
+	c := checkpoint{Params: p, Turn: turn, X: x, Y: y, World: world.rows(0, world.height)}
+	file, err := ioutil.TempFile(p.CheckpointDir, ".checkpoint")
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(file).Encode(c)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), checkpointPath(p, turn))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	if previous != turn {
+		os.Remove(checkpointPath(p, previous))
+	}
+	return nil
+}
+
+// checkpointPath returns the path of the checkpoint for turn.
+func checkpointPath(p Params, turn int) string {
+	return filepath.Join(p.CheckpointDir, fmt.Sprintf("%dx%dx%d.checkpoint", p.ImageHeight, p.ImageWidth, turn))
+}
@@ -0,0 +1,199 @@
+package gol
+
+import (
+	"errors"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// The errors returned by the methods of a Controller when a run can't carry out a command.
+var (
+	// ErrPaused is returned by Pause if the run is already paused.
+	ErrPaused = errors.New("the run is already paused")
+	// ErrNotPaused is returned by Resume, Step and Back if the run isn't paused.
+	ErrNotPaused = errors.New("the run isn't paused")
+	// ErrNoHistory is returned by Back if no earlier turns are kept, as at the start of the run.
+	ErrNoHistory = errors.New("there are no earlier turns to step back to")
+	// ErrFinished is returned once the run has finished.
+	ErrFinished = errors.New("the run has finished")
+)
+
+// op is a command that a Controller sends to its run.
+type op int
+
+const (
+	opPause op = iota
+	opResume
+	opStep
+	opBack
+	opSnapshot
+	opSave
+	opQuit
+	opKill
+)
+
+// command is sent by a Controller to its run, which replies once it has carried the command out.
+type command struct {
+	op    op
+	n     int    // the number of turns to step
+	path  string // the file to save the world in
+	reply chan<- result
+}
+
+// result is the reply to a command, with the number of turns completed once it was carried out.
+type result struct {
+	turn  int
+	alive []util.Cell // the alive cells of a snapshot
+	err   error
+}
+
+// defaultFastForward is the number of turns that 'f' steps a paused run by if Params.FastForward is 0.
+const defaultFastForward = 100
+
+// Controller controls a run of the Game of Life, started by Start or attached to by Attach. Its methods
+// block until the run has carried them out, and can be called from any goroutine.
+type Controller struct {
+	commands    chan<- command
+	fastForward int           // the number of turns that 'f' steps by
+	done        chan struct{} // closed once the run has finished
+	err         error         // the error the run finished with, set before done is closed
+}
+
+// newController returns a Controller for a run of p, which sends its commands down commands.
+func newController(commands chan<- command, p Params) *Controller {
+	c := &Controller{commands: commands, fastForward: p.FastForward, done: make(chan struct{})}
+	if c.fastForward == 0 {
+		c.fastForward = defaultFastForward
+	}
+	return c
+}
+
+// finish records the error the run finished with, and lets every caller know it has finished.
+func (c *Controller) finish(err error) {
+	c.err = err
+	close(c.done)
+}
+
+// call sends a command to the run, and waits for its reply.
+func (c *Controller) call(cmd command) result {
+	reply := make(chan result, 1)
+	cmd.reply = reply
+	select {
+	case c.commands <- cmd:
+		return <-reply
+	case <-c.done:
+		return result{err: ErrFinished}
+	}
+}
+
+// Pause pauses the run after the turn it is on, and returns the number of turns completed.
+func (c *Controller) Pause() (int, error) {
+	r := c.call(command{op: opPause})
+	return r.turn, r.err
+}
+
+// Resume carries on with a paused run, and returns the number of turns completed.
+func (c *Controller) Resume() (int, error) {
+	r := c.call(command{op: opResume})
+	return r.turn, r.err
+}
+
+// Step progresses a paused run by n turns, or to the end of the run if that is sooner, and returns the
+// number of turns completed. The run stays paused.
+func (c *Controller) Step(n int) (int, error) {
+	r := c.call(command{op: opStep, n: n})
+	return r.turn, r.err
+}
+
+// Back steps a paused run back to the turn before the latest, or to the start of the latest leap of HashLife,
+// and returns the number of turns completed. Only the latest Params.History turns are kept, and none for a
+// headless run. The run stays paused, and carries on from there once it is stepped or resumed.
+func (c *Controller) Back() (int, error) {
+	r := c.call(command{op: opBack})
+	return r.turn, r.err
+}
+
+// Snapshot returns the alive cells of the world and the number of turns completed.
+func (c *Controller) Snapshot() ([]util.Cell, int, error) {
+	r := c.call(command{op: opSnapshot})
+	return r.alive, r.turn, r.err
+}
+
+// Save writes the world to path once it has been saved, as an RLE pattern if path ends in .rle and a PGM
+// image if it ends in .pgm, and returns the number of turns completed. If path is empty, the world is saved
+// in out as usual, named after its size and the turn.
+func (c *Controller) Save(path string) (int, error) {
+	r := c.call(command{op: opSave, path: path})
+	return r.turn, r.err
+}
+
+// Quit ends the run after the turn it is on, once the final world has been written, and returns the error
+// the run finished with. A controller attached to a server detaches from it instead, leaving it running.
+func (c *Controller) Quit() error {
+	if r := c.call(command{op: opQuit}); r.err != nil && r.err != ErrFinished {
+		return r.err
+	}
+	return c.Wait()
+}
+
+// Kill ends the run as Quit does, and shuts down the broker and its workers in distributed mode, or the
+// server of a controller attached to one.
+func (c *Controller) Kill() error {
+	if r := c.call(command{op: opKill}); r.err != nil && r.err != ErrFinished {
+		return r.err
+	}
+	return c.Wait()
+}
+
+// Wait waits for the run to finish, and returns the error it finished with, such as an input that couldn't
+// be read or a broker that failed.
+func (c *Controller) Wait() error {
+	<-c.done
+	return c.err
+}
+
+// Done returns a channel that is closed once the run has finished.
+func (c *Controller) Done() <-chan struct{} {
+	return c.done
+}
+
+// Press carries out the command of a key press: 'p' pauses the run or resumes it if it is paused, 'n' steps
+// a paused run by a turn, 'f' by Params.FastForward turns and 'b' back a turn, 's' saves the world in out,
+// 'q' quits and 'k' kills the run. Other keys are ignored.
+func (c *Controller) Press(key rune) error {
+	var err error
+	switch key {
+	case 'p':
+		if _, err = c.Pause(); err == ErrPaused {
+			_, err = c.Resume()
+		}
+	case 'n':
+		_, err = c.Step(1)
+	case 'f':
+		_, err = c.Step(c.fastForward)
+	case 'b':
+		_, err = c.Back()
+	case 's':
+		_, err = c.Save("")
+	case 'q':
+		err = c.Quit()
+	case 'k':
+		err = c.Kill()
+	}
+	return err
+}
+
+// pressKeys presses every key sent down keyPresses until the run has finished.
+func (c *Controller) pressKeys(keyPresses <-chan rune) {
+	for {
+		select {
+		case key, ok := <-keyPresses:
+			if !ok {
+				return
+			}
+			c.Press(key)
+		case <-c.done:
+			return
+		}
+	}
+}
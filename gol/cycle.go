@@ -0,0 +1,101 @@
+package gol
+
+import "uk.ac.bris.cs/gameoflife/util"
+
+// maxCyclePeriod is the longest period of a cycle that is detected, as the hash of the world after each of
+// that many turns is kept.
+const maxCyclePeriod = 1024
+
+// cycles detects when the world has become static or periodic, by looking for the hash of the world after a
+// turn among those of the latest maxCyclePeriod turns. The hash is the exclusive or of a hash of every cell
+// that isn't dead and its state (Zobrist hashing), so it is updated from the cells that change every turn
+// rather than the whole world.
+type cycles struct {
+	hash   uint64
+	seen   map[uint64]int // the turn on which each of the latest hashes was seen
+	latest []uint64       // the latest hashes, by turn modulo maxCyclePeriod
+	states int
+}
+
+// newCycles starts detecting cycles from world after turn, whose top left cell is (x, y).
+func newCycles(world *board, x, y, turn, states int) *cycles {
+	c := &cycles{states: states}
+	for cy := 0; cy < world.height; cy++ {
+		for cx := 0; cx < world.width; cx++ {
+			c.hash ^= cellHash(util.Cell{X: x + cx, Y: y + cy}, world.state(cx, cy))
+		}
+	}
+	c.reset(turn)
+	return c
+}
+
+// reset forgets every hash but that of the world after turn.
+func (c *cycles) reset(turn int) {
+	c.seen = map[uint64]int{c.hash: turn}
+	c.latest = make([]uint64, maxCyclePeriod)
+	c.latest[turn%maxCyclePeriod] = c.hash
+}
+
+// apply updates the hash with a delta, in either direction.
+func (c *cycles) apply(d delta) {
+	if c.states > 2 {
+		for i, cell := range d.changed {
+			c.hash ^= cellHash(cell, previousState(d.states[i], c.states)) ^ cellHash(cell, d.states[i])
+		}
+	} else {
+		for _, cell := range d.flipped {
+			c.hash ^= cellHash(cell, alive)
+		}
+	}
+}
+
+// update applies the delta of a turn that ends after turn, and returns the turn the world was last the
+// same on if it is one of the latest maxCyclePeriod.
+func (c *cycles) update(d delta, turn int) (int, bool) {
+	c.apply(d)
+	if start, ok := c.seen[c.hash]; ok {
+		return start, true
+	}
+	slot := turn % maxCyclePeriod
+	if oldest, ok := c.seen[c.latest[slot]]; ok && oldest == turn-maxCyclePeriod {
+		delete(c.seen, c.latest[slot])
+	}
+	c.latest[slot] = c.hash
+	c.seen[c.hash] = turn
+	return 0, false
+}
+
+// repeat is a world that the hashes say is the same as one period before it. As hashes can collide, it is
+// only confirmed to be periodic once it is the same again a period later.
+type repeat struct {
+	world  *board
+	x, y   int
+	period int
+	turn   int // the turn after which the world should be the same again
+}
+
+// newRepeat keeps the world of engine after turn, which the hashes say repeats every period turns.
+func newRepeat(world engine, turn, period int) *repeat {
+	snapshot, x, y := world.snapshot()
+	return &repeat{snapshot, x, y, period, turn + period}
+}
+
+// confirmed reports whether the world of engine is the same as the one kept.
+func (r *repeat) confirmed(world engine) bool {
+	snapshot, x, y := world.snapshot()
+	return x == r.x && y == r.y && snapshot.equal(r.world)
+}
+
+// cellHash returns the hash of a cell in the given state, which is 0 for dead cells so that they can be
+// left out of the hash of a world.
+func cellHash(cell util.Cell, state uint8) uint64 {
+	if state == dead {
+		return 0
+	}
+	//The finaliser of splitmix64, which spreads every bit of its input across the hash
+	h := uint64(uint32(cell.X)) | uint64(uint32(cell.Y))<<32
+	h += uint64(state) * 0x9e3779b97f4a7c15
+	h = (h ^ h>>30) * 0xbf58476d1ce4e5b9
+	h = (h ^ h>>27) * 0x94d049bb133111eb
+	return h ^ h>>31
+}
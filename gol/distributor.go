@@ -2,7 +2,8 @@ package gol
 
 import (
 	"fmt"
-	"sync"
+	"os"
+	"path/filepath"
 	"time"
 	"uk.ac.bris.cs/gameoflife/util"
 )
@@ -12,91 +13,334 @@ type distributorChannels struct {
 	ioCommand  chan<- ioCommand
 	ioIdle     <-chan bool
 	ioFilename chan<- string
+	ioBounds   chan<- imageBounds
+	ioErrors   <-chan error
 	ioOutput   chan<- uint8
 	ioInput    <-chan uint8
 }
 
+// aliveCountInterval is how often an AliveCellsCount event is sent while the run is executing.
+const aliveCountInterval = 2 * time.Second
+
+// engine progresses the world one turn at a time, keeping track of the cells that change.
+// It is only ever used by the distributor goroutine.
+type engine interface {
+	step(turn int)
+	aliveCount() int
+	// snapshot returns a copy of the world, and the coordinates of its top left cell.
+	snapshot() (world *board, x, y int)
+	// changes returns the cells that flipped since it was last called, and under Generations rules every cell
+	// that changed state, which the distributor sends events for. The slices are no longer used by the engine.
+	changes() delta
+	stop()
+}
+
+// leaper is an engine that can progress many turns at once, only keeping track of the cells that differ at
+// the end. leap progresses the world by at least 1 and at most turns turns, and returns how many.
+type leaper interface {
+	leap(turn, turns int) int
+}
+
+// faulty is an engine that can fail part way through a run, such as one whose world is on other machines.
+type faulty interface {
+	err() error
+}
+
+// killable is an engine whose world is on other machines, which shuts them down when the run is killed with 'k'.
+type killable interface {
+	kill()
+}
+
 // distributor divides the work between workers and interacts with other goroutines.
-func distributor(p Params, c distributorChannels, keyPresses <-chan rune) {
-	//Activate IO to output world:
-	c.ioCommand <- ioInput
-	c.ioFilename <- fmt.Sprintf("%dx%d", p.ImageHeight, p.ImageWidth)
-
-	//Create 2D slice and store received world in it, also send live cells down cell flipped
-	startWorld := make([][]byte, p.ImageHeight)
-	for y := 0; y < p.ImageHeight; y++ {
-		startWorld[y] = make([]byte, p.ImageWidth)
-		for x := 0; x < p.ImageWidth; x++ {
-			cell := <-c.ioInput
-			if cell == 255 {
-				c.events <- CellFlipped{0, util.Cell{x, y}}
+// If resume isn't nil, the run carries on from the world it holds instead of reading the input.
+// It returns an error if the input can't be read, or if the broker fails in distributed mode.
+func distributor(p Params, r rule, resume *checkpoint, c distributorChannels, commands <-chan command) error {
+	var startWorld *board
+	turn, startX, startY := 0, 0, 0
+	if resume != nil {
+		//Carry on from the world of the checkpoint, on the turn it was saved on
+		startWorld, turn, startX, startY = resume.World.board(), resume.Turn, resume.X, resume.Y
+	} else {
+		//Activate IO to output world:
+		c.ioCommand <- ioInput
+		if p.Input != "" {
+			c.ioFilename <- p.Input
+		} else {
+			c.ioFilename <- fmt.Sprintf("images/%dx%d.pgm", p.ImageHeight, p.ImageWidth)
+		}
+		if err := <-c.ioErrors; err != nil {
+			close(c.events)
+			return err
+		}
+
+		//Create board and store received world in it
+		startWorld = newBoard(p.ImageWidth, p.ImageHeight, r.states)
+		for y := 0; y < p.ImageHeight; y++ {
+			for x := 0; x < p.ImageWidth; x++ {
+				if state := <-c.ioInput; state != dead {
+					startWorld.setState(x, y, state)
+				}
 			}
-			startWorld[y][x] = cell
 		}
 	}
 
-	worldChan := make(chan func(y, x int) byte, 1)
-	safeWorld := makeSafeWorld(startWorld, p)
-	worldChan <- safeWorld
+	//Send the live cells down cell flipped, on the turn the world starts from
+	var initial delta
+	for y := 0; y < startWorld.height; y++ {
+		for x := 0; x < startWorld.width; x++ {
+			state, cell := startWorld.state(x, y), util.Cell{X: startX + x, Y: startY + y}
+			if state == alive {
+				initial.flipped = append(initial.flipped, cell)
+			}
+			if state != dead && r.states > 2 {
+				initial.changed = append(initial.changed, cell)
+				initial.states = append(initial.states, state)
+			}
+		}
+	}
+	sendChanges(p, c.events, turn, initial)
 
-	//sectionLengths shows how to divide up board into threads
-	sectionLengths := make([]int, p.Threads+1)
-	sectionLength := p.ImageHeight / p.Threads
-	remainingLength := p.ImageHeight % p.Threads
-	sectionLengths[0] = 0
-	for i := 1; i < p.Threads+1; i++ {
-		sectionLengths[i] = sectionLengths[i-1] + sectionLength //each section is sectionLength
-		if i <= remainingLength {
-			sectionLengths[i]++ //the remaining length is distributed between threads
+	//The cells changed in the latest turns are kept for stepping back, unless the run is headless as
+	//they aren't all sent
+	var past *history
+	if !p.Headless {
+		turns := p.History
+		if turns == 0 {
+			turns = defaultHistory
 		}
+		past = newHistory(turns)
+	}
+	//start starts the engine on b, whose top left cell is (x, y), from the current turn
+	start := func(b *board, x, y int) (engine, error) {
+		switch {
+		case p.Broker != "":
+			e, err := newRemote(p.Broker, b, turn, r, p.Topology, !p.Headless, c.events)
+			if err != nil {
+				return nil, err
+			}
+			return e, nil
+		case p.Engine == HashLife:
+			return newHashLife(b, x, y, r, p.Unbounded, p.HashLifeMemory), nil
+		case p.Unbounded:
+			return newSparse(b, x, y, p.Threads, r), nil
+		default:
+			return newStrips(b, turn, p.Threads, r, p.Topology), nil
+		}
+	}
+	world, err := start(startWorld, startX, startY)
+	if err != nil {
+		close(c.events)
+		return err
 	}
 
-	var wg sync.WaitGroup
-	turn := 0
-	timer := time.NewTimer(2 * time.Second)
-	qPressed := false
+	//Cycles are found from the changed cells, so not on a broker in a headless run as it doesn't send them,
+	//and HashLife leaps over them instead
+	var cycle *cycles
+	if _, ok := world.(leaper); !ok && !(p.Broker != "" && p.Headless) {
+		cycle = newCycles(startWorld, startX, startY, turn, r.states)
+	}
+	detected, skipTo := false, -1
+	var repeated *repeat
 
-	for turn < p.Turns {
-		select {
-		case safeWorld = <-worldChan:
-			c.events <- TurnComplete{turn}
-			worldChan <- safeWorld
-			wg.Add(1)
-			go distributeTurn(worldChan, sectionLengths, p, &wg, c, turn)
-			wg.Wait()
-			turn++
+	//The alive cells are counted every 2s while the run is executing, and the ticker is replaced on resuming
+	//so that a paused run doesn't count them as soon as it resumes
+	ticker := time.NewTicker(aliveCountInterval)
+	defer func() { ticker.Stop() }()
 
-		case <-timer.C:
-			timer.Reset(2 * time.Second)
-			safeWorld = <-worldChan
-			c.events <- AliveCellsCount{turn, len(calculateAliveCells(safeWorld, p))}
-			worldChan <- safeWorld
-		case key := <-keyPresses:
-			switch key {
-			case 's':
-				safeWorld = <-worldChan
-				go sendWorldToPGM(safeWorld, turn, p, c)
-				worldChan <- safeWorld
-			case 'q':
-				qPressed = true
-			case 'p':
-				println("Paused on turn", turn)
-				for 'p' != <-keyPresses {
+	//Checkpoints are only saved if there is somewhere to save them
+	var checkpoints <-chan time.Time
+	lastCheckpoint := turn
+	if p.CheckpointDir != "" {
+		interval := p.CheckpointInterval
+		if interval == 0 {
+			interval = defaultCheckpointInterval
+		}
+		checkpointTicker := time.NewTicker(interval)
+		defer checkpointTicker.Stop()
+		checkpoints = checkpointTicker.C
+	}
+	checkpoint := func(snapshot *board, x, y int) {
+		if err := saveCheckpoint(p, r, snapshot, x, y, turn, lastCheckpoint); err != nil {
+			fmt.Println("Checkpoint failed:", err)
+			return
+		}
+		lastCheckpoint = turn
+	}
+
+	//advance progresses the world by at least 1 and at most turns turns
+	advance := func(turns int) {
+		from := turn
+		if l, ok := world.(leaper); ok {
+			turn += l.leap(turn, turns)
+		} else {
+			world.step(turn)
+			turn++
+		}
+		//The changes are taken even if they aren't kept, so that the engine doesn't hold on to them
+		d := world.changes()
+		d.turn = from
+		if past != nil {
+			past.add(d)
+		}
+		sendChanges(p, c.events, turn, d)
+		c.events <- TurnComplete{turn}
+		if cycle != nil {
+			if start, ok := cycle.update(d, turn); ok && !detected {
+				detected = true
+				c.events <- CycleDetected{turn, start, turn - start}
+				if p.StopOnCycle && turn < p.Turns {
+					repeated = newRepeat(world, turn, turn-start)
 				}
-				println("Continuing")
 			}
+		}
+		//The world is only skipped ahead once it has been seen to repeat, rather than trusting the hashes
+		if repeated != nil && turn == repeated.turn {
+			if repeated.confirmed(world) {
+				skipTo = turn + (p.Turns-turn)%repeated.period
+			} else {
+				detected = false
+			}
+			repeated = nil
+		}
+		//Once the cycle has reached the same point in it as the last turn, the world is the same
+		if turn == skipTo {
+			turn = p.Turns
+			c.events <- TurnComplete{turn}
+		}
+	}
+	//back restarts the engine from the world before the latest turn kept, sending the cells it changes back
+	var broken error
+	back := func() bool {
+		d, ok := past.pop()
+		if !ok {
+			return false
+		}
+		snapshot, x, y := world.snapshot()
+		world.stop()
+		snapshot, x, y = d.undo(snapshot, x, y, r.states)
+		reverse := delta{flipped: d.flipped, changed: d.changed}
+		for _, state := range d.states {
+			reverse.states = append(reverse.states, previousState(state, r.states))
+		}
+		sendChanges(p, c.events, d.turn, reverse)
+		turn = d.turn
+		if cycle != nil {
+			cycle.apply(d)
+			cycle.reset(turn)
+			detected, skipTo, repeated = false, -1, nil
+		}
+		world, broken = start(snapshot, x, y)
+		c.events <- TurnComplete{turn}
+		return true
+	}
+	failed := func() bool {
+		f, ok := world.(faulty)
+		return broken != nil || ok && f.err() != nil
+	}
+
+	c.events <- StateChange{turn, Executing}
+	paused, quit, kill := false, false, false
+	control := func(cmd command) {
+		r := result{turn: turn}
+		switch cmd.op {
+		case opPause:
+			if paused {
+				r.err = ErrPaused
+				break
+			}
+			paused = true
+			ticker.Stop()
+			c.events <- StateChange{turn, Paused}
+		case opResume:
+			if !paused {
+				r.err = ErrNotPaused
+				break
+			}
+			paused = false
+			ticker = time.NewTicker(aliveCountInterval)
+			c.events <- StateChange{turn, Executing}
+		case opStep:
+			if !paused {
+				r.err = ErrNotPaused
+				break
+			}
+			if cmd.n < 1 {
+				r.err = fmt.Errorf("can't step %d turns", cmd.n)
+				break
+			}
+			target := turn + cmd.n
+			if target > p.Turns {
+				target = p.Turns
+			}
+			for turn < target && !failed() {
+				advance(target - turn)
+			}
+			r.turn = turn
+		case opBack:
+			switch {
+			case !paused:
+				r.err = ErrNotPaused
+			case past == nil || !back():
+				r.err = ErrNoHistory
+			}
+			r.turn = turn
+		case opSnapshot:
+			r.alive = offsetCells(world.snapshot())
+		case opSave:
+			//The engine reuses its boards, so output a copy
+			snapshot, x, y := world.snapshot()
+			if r.err = checkSavePath(cmd.path); r.err == nil {
+				sendWorldToOutput(snapshot, x, y, turn, cmd.path, p, c)
+				c.ioCommand <- ioCheckIdle
+				<-c.ioIdle
+			}
+		case opQuit:
+			quit = true
+		case opKill:
+			kill = true
+		}
+		cmd.reply <- r
+	}
 
+	for turn < p.Turns && !quit && !kill && !failed() {
+		//A paused run only waits for commands
+		if paused {
+			control(<-commands)
+			continue
 		}
-		if qPressed {
-			break
+		select {
+		case <-ticker.C:
+			c.events <- AliveCellsCount{turn, world.aliveCount()}
+		case <-checkpoints:
+			checkpoint(world.snapshot())
+		case cmd := <-commands:
+			control(cmd)
+		default:
+			advance(p.Turns - turn)
 		}
+	}
+	if broken != nil {
+		close(c.events)
+		return broken
+	}
+	if failed() {
+		world.stop()
+		close(c.events)
+		return world.(faulty).err()
+	}
 
+	final, x, y := world.snapshot()
+	if p.CheckpointDir != "" {
+		checkpoint(final, x, y)
+	}
+	if k, ok := world.(killable); ok && kill {
+		k.kill()
 	}
+	world.stop()
 
 	//Send final world to io
-	safeWorld = <-worldChan
-	sendWorldToPGM(safeWorld, turn, p, c)
-	c.events <- FinalTurnComplete{turn, calculateAliveCells(safeWorld, p)}
+	sendWorldToOutput(final, x, y, turn, "", p, c)
+	c.events <- FinalTurnComplete{turn, offsetCells(final, x, y)}
 
 	// Make sure that the Io has finished any output before exiting.
 	c.ioCommand <- ioCheckIdle
@@ -106,123 +350,73 @@ func distributor(p Params, c distributorChannels, keyPresses <-chan rune) {
 
 	// Close the channel to stop the SDL goroutine gracefully. Removing may cause deadlock.
 	close(c.events)
+	return nil
 }
 
-// Makes a closure on a 2D slice with wrapped indexing
-func makeSafeWorld(matrix [][]byte, p Params) func(y, x int) byte {
-	return func(y, x int) byte {
-		return matrix[(y+p.ImageHeight)%p.ImageHeight][(x+p.ImageWidth)%p.ImageWidth]
+//Prepares io for output in the output format and sends board down it a cell state at a time.
+//originX and originY are the coordinates of its top left cell, which are only nonzero in an unbounded universe.
+//The world is written to path, or to out named after its size and the turn if path is empty
+func sendWorldToOutput(world *board, originX, originY, turn int, path string, p Params, c distributorChannels) {
+	format := p.OutputFormat
+	if format == "" {
+		format = "pgm"
 	}
-}
-
-// Divides up world from worldChan into number of threads and calls progressWorld on them, sends newWorld back down worldChan
-func distributeTurn(worldChan chan func(y, x int) byte, sectionLengths []int, p Params, wg *sync.WaitGroup, c distributorChannels, turn int) {
-	oldWorld := <-worldChan
-
-	//Create channels for each thread
-	subWorlds := make([]chan [][]byte, p.Threads)
-	for i := 0; i < p.Threads; i++ {
-		subWorlds[i] = make(chan [][]byte)
-	}
-
-	//Divide up world and call progressWorld on each segment
-	for i := 0; i < p.Threads; i++ {
-		startY := sectionLengths[i]
-		endY := sectionLengths[i+1]
-		go progressWorld(oldWorld, subWorlds[i], p.ImageWidth, startY, endY, c, turn)
-	}
-
-	//Collect progressed world:
-	var newWorld [][]byte
-	for i := 0; i < p.Threads; i++ {
-		newWorld = append(newWorld, <-subWorlds[i]...)
+	c.ioCommand <- ioOutput
+	if path != "" {
+		c.ioFilename <- path
+	} else if p.Unbounded {
+		c.ioFilename <- fmt.Sprintf("out/%dx%dx%d@%d,%d.%s", world.height, world.width, turn, originX, originY, format)
+	} else {
+		c.ioFilename <- fmt.Sprintf("out/%dx%dx%d.%s", p.ImageHeight, p.ImageWidth, turn, format)
 	}
-
-	worldChan <- makeSafeWorld(newWorld, p)
-	wg.Done()
-}
-
-// Progresses section of world and sends results down out, sends updated cells down c.events
-func progressWorld(oldWorld func(y, x int) byte, out chan<- [][]byte, width, startY, endY int, c distributorChannels, turn int) {
-	//Make newWorld
-	newWorld := make([][]byte, endY-startY)
-	for y := 0; y < endY-startY; y++ {
-		newWorld[y] = make([]byte, width)
-	}
-
-	//Calculate contents of newWorld
-	for y := startY; y < endY; y++ {
-		for x := 0; x < width; x++ {
-			liveNeighbours := countNeighbours(oldWorld, y, x)
-			if oldWorld(y, x) == 255 { //if cells alive:
-				if liveNeighbours == 2 || liveNeighbours == 3 { //any live cell with two or three live neighbours is unaffected
-					newWorld[y-startY][x] = 255
-				} else { //cell dies, (slices are init to 0 so don't need to write to newWorld)
-					c.events <- CellFlipped{turn, util.Cell{x, y}}
-				}
-			} else { //cells dead
-				if liveNeighbours == 3 { //any dead cell with exactly three live neighbours becomes alive
-					newWorld[y-startY][x] = 255
-					c.events <- CellFlipped{turn, util.Cell{x, y}}
-				}
-			}
+	c.ioBounds <- imageBounds{originX, originY, world.width, world.height}
+	for y := 0; y < world.height; y++ {
+		for x := 0; x < world.width; x++ {
+			c.ioOutput <- world.state(x, y)
 		}
 	}
-
-	out <- newWorld
 }
 
-//Returns the number of alive neighbours of a given cell
-func countNeighbours(board func(y, x int) byte, y, x int) int8 {
-	var count int8 = 0
-	if board(y+1, x+1) == 255 {
-		count++
-	}
-	if board(y+1, x) == 255 {
-		count++
-	}
-	if board(y+1, x-1) == 255 {
-		count++
-	}
-	if board(y, x+1) == 255 {
-		count++
-	}
-	if board(y, x-1) == 255 {
-		count++
-	}
-	if board(y-1, x+1) == 255 {
-		count++
-	}
-	if board(y-1, x) == 255 {
-		count++
+//Sends the cells of d that flipped on turn down events, in a CellsFlipped event or a CellFlipped event for each
+//of them, followed by a CellStateChanged event for every cell that changed state under a Generations rule
+func sendChanges(p Params, events chan<- Event, turn int, d delta) {
+	if p.CellFlippedEvents {
+		for _, cell := range d.flipped {
+			events <- CellFlipped{turn, cell}
+		}
+	} else if len(d.flipped) > 0 {
+		events <- CellsFlipped{turn, d.flipped}
 	}
-	if board(y-1, x-1) == 255 {
-		count++
+	for i, cell := range d.changed {
+		events <- CellStateChanged{turn, cell, d.states[i]}
 	}
-
-	return count
 }
 
-//Returns list of all alive cells in board
-func calculateAliveCells(board func(y, x int) byte, p Params) []util.Cell {
-	cells := make([]util.Cell, 0)
-	for y := 0; y < p.ImageHeight; y++ {
-		for x := 0; x < p.ImageWidth; x++ {
-			if board(y, x) == 255 {
-				cells = append(cells, util.Cell{x, y})
-			}
-		}
+//Returns the alive cells of world, whose top left cell is (x, y)
+func offsetCells(world *board, x, y int) []util.Cell {
+	alive := world.aliveCells()
+	for i := range alive {
+		alive[i].X += x
+		alive[i].Y += y
 	}
-	return cells
+	return alive
 }
 
-//Prepares io for output and sends board down it a pixel at a time
-func sendWorldToPGM(world func(y, x int) uint8, turn int, p Params, c distributorChannels) {
-	c.ioCommand <- ioOutput
-	c.ioFilename <- fmt.Sprintf("%dx%dx%d", p.ImageHeight, p.ImageWidth, turn)
-	for y := 0; y < p.ImageHeight; y++ {
-		for x := 0; x < p.ImageWidth; x++ {
-			c.ioOutput <- world(y, x)
-		}
+//Returns an error unless the world can be saved at path, which may be empty to save it in out as usual
+func checkSavePath(path string) error {
+	if path == "" {
+		return nil
+	}
+	if ext := filepath.Ext(path); ext != ".pgm" && ext != ".rle" {
+		return fmt.Errorf("unknown output format %q: expected a .pgm or .rle file", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	//The io goroutine can't report errors once it has started writing
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return err
 	}
+	return file.Close()
 }
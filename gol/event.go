@@ -14,8 +14,14 @@ type Event interface {
 	GetCompletedTurns() int
 }
 
+// eventTypes holds an event of every type, for the encodings that need to know them all.
+var eventTypes = []Event{
+	AliveCellsCount{}, ImageOutputComplete{}, StateChange{}, CellFlipped{}, CellsFlipped{}, CellStateChanged{},
+	ClusterChange{}, CycleDetected{}, TurnComplete{}, FinalTurnComplete{},
+}
+
 // AliveCellsCount is an Event notifying the user about the number of currently alive cells.
-// This Event should be sent every 2s.
+// This Event should be sent every 2s, while the execution isn't paused.
 type AliveCellsCount struct { // implements Event
 	CompletedTurns int
 	CellsCount     int
@@ -38,7 +44,9 @@ const (
 )
 
 // StateChange is an Event notifying the user about the change of state of execution.
-// This Event should be sent every time the execution is paused, resumed or quit.
+// This Event should be sent every time the execution is paused, resumed or quit, with the number of turns
+// completed when it was. Executing is also sent when the execution starts, after the CellFlipped events of
+// the initial world, and Quitting is the last event, after FinalTurnComplete.
 type StateChange struct { // implements Event
 	CompletedTurns int
 	NewState       State
@@ -52,9 +60,50 @@ type CellFlipped struct { // implements Event
 	Cell           util.Cell
 }
 
+// CellsFlipped is an Event notifying the GUI about a change of state of every cell that flipped in a turn, or
+// in a HashLife leap, so that a busy turn is a single event rather than one for every cell. It is sent
+// instead of CellFlipped events unless Params.CellFlippedEvents is set, including for all cells that are
+// alive when the image is loaded in. Cells is shared between every consumer of the event, so it must not be
+// modified.
+type CellsFlipped struct { // implements Event
+	CompletedTurns int
+	Cells          []util.Cell
+}
+
+// CellStateChanged is an Event notifying the GUI about a change of state of a single cell under a
+// Generations rule, where dying cells pass through refractory states (2 and above) before they are dead (0).
+// This event should be sent every time a cell changes state, after any CellFlipped or CellsFlipped event for
+// the same cell.
+// Make sure to send this event for all cells that are not dead when the image is loaded in.
+type CellStateChanged struct { // implements Event
+	CompletedTurns int
+	Cell           util.Cell
+	State          uint8
+}
+
+// ClusterChange is an Event notifying the user that the broker has lost workers in distributed mode, and
+// now splits the world between the Workers that are left. Their strips were recovered from the world at
+// CompletedTurns, so the run carries on as if nothing had happened.
+type ClusterChange struct { // implements Event
+	CompletedTurns int
+	Workers        int
+}
+
+// CycleDetected is an Event notifying the user that the world has become static or periodic: the world
+// after CompletedTurns is the same as it was after Start, and it repeats itself every Period turns from then
+// on. A static world has a period of 1. It is sent once, or again if the run is stepped back and finds the
+// cycle again, but never for HashLife, which leaps over cycles anyway.
+type CycleDetected struct { // implements Event
+	CompletedTurns int
+	Start          int
+	Period         int
+}
+
 // TurnComplete is an Event notifying the GUI about turn completion.
 // SDL will render a frame when this event is sent.
-// All CellFlipped events must be sent *before* TurnComplete.
+// All CellFlipped and CellsFlipped events must be sent *before* TurnComplete.
+// When a paused run is stepped back, the cells that change back are flipped again and TurnComplete is sent
+// with the earlier turn.
 type TurnComplete struct { // implements Event
 	CompletedTurns int
 }
@@ -114,6 +163,41 @@ func (event CellFlipped) GetCompletedTurns() int {
 	return event.CompletedTurns
 }
 
+func (event CellsFlipped) String() string {
+	return fmt.Sprintf("")
+}
+
+func (event CellsFlipped) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
+func (event CellStateChanged) String() string {
+	return fmt.Sprintf("")
+}
+
+func (event CellStateChanged) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
+func (event ClusterChange) String() string {
+	return fmt.Sprintf("Cluster shrank to %v workers", event.Workers)
+}
+
+func (event ClusterChange) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
+func (event CycleDetected) String() string {
+	if event.Period == 1 {
+		return fmt.Sprintf("Static since turn %v", event.Start)
+	}
+	return fmt.Sprintf("Period %v cycle since turn %v", event.Period, event.Start)
+}
+
+func (event CycleDetected) GetCompletedTurns() int {
+	return event.CompletedTurns
+}
+
 func (event TurnComplete) String() string {
 	return fmt.Sprintf("")
 }
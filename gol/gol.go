@@ -1,19 +1,215 @@
 package gol
 
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
 // Params provides the details of how to run the Game of Life and which image to load.
 type Params struct {
 	Turns       int
 	Threads     int
 	ImageWidth  int
 	ImageHeight int
+
+	// Rule is the life-like rule to run, in B/S notation (e.g. B36/S23) or legacy S/B notation (e.g. 23/36).
+	// Generations rules also give the number of cell states, as in B2/S/C3 or /2/3, and Larger than Life
+	// rules use Golly's notation, as in R5,C0,M1,S34..58,B34..45,NM.
+	// If it is empty, the rule in the header of an RLE input is used, or Conway's Game of Life (B3/S23).
+	Rule string
+
+	// Input is the path of the pattern to load: a Netpbm image (.pgm or .pbm, of the image size) or a .rle
+	// pattern file, which is placed in the top left corner of the world and must fit in it.
+	// images/<ImageWidth>x<ImageHeight>.pgm is used if it is empty.
+	Input string
+
+	// OutputFormat is the format the world is saved in, pgm (the default) or rle.
+	OutputFormat string
+
+	// Topology is how the edges of the world are joined together, a torus by default.
+	Topology Topology
+
+	// Unbounded places the image at the origin of an infinite plane instead, which only holds the areas
+	// around alive cells, so cell coordinates may be negative or beyond the image. Output images cover
+	// the bounding box of the alive cells. Only life-like rules without B0 are supported.
+	Unbounded bool
+
+	// Engine is the algorithm used to progress the world. HashLife only supports life-like rules without B0,
+	// and bounded worlds that are square tori whose size is a power of two.
+	Engine Engine
+
+	// HashLifeMemory is the ceiling of the HashLife node cache in megabytes, beyond which the nodes that
+	// are no longer part of the world are forgotten, even part way through a leap. The cache only grows
+	// past it if the world alone needs more. 1024 is used if it is 0.
+	HashLifeMemory int
+
+	// Broker is the address of a broker (see ServeBroker) to run the world on, split into a strip for each
+	// of its workers instead of Threads goroutines. Events and images are still produced locally.
+	// Only the parallel engine is supported, in a bounded world that isn't a cross-surface, under
+	// life-like and Generations rules.
+	Broker string
+
+	// Headless is set when nothing is watching cells change, such as a window, so CellsFlipped and
+	// CellStateChanged events don't need to be sent after those for the initial world. Only a broker
+	// skips them at the moment, as every changed cell would otherwise be sent over the network.
+	Headless bool
+
+	// CellFlippedEvents sends a CellFlipped event for every cell that flips instead of a CellsFlipped event
+	// for every turn, for consumers that only know about those.
+	CellFlippedEvents bool
+
+	// CheckpointDir is the directory that the state of the run is saved in every CheckpointInterval, and
+	// at the end of the run, so that a later run can resume from it. Only the latest checkpoint is kept,
+	// as <ImageHeight>x<ImageWidth>x<turn>.checkpoint. Nothing is saved if it is empty.
+	CheckpointDir string
+
+	// CheckpointInterval is how often a checkpoint is saved, every minute if it is 0.
+	CheckpointInterval time.Duration
+
+	// FastForward is the number of turns that 'f' steps a paused run by (see Controller.Press), 100 if it is 0.
+	FastForward int
+
+	// StopOnCycle ends the run as soon as its world is found to be static or periodic (see CycleDetected),
+	// with the world it would have after Turns turns. HashLife leaps over cycles instead, and a Headless run
+	// on a Broker doesn't look for them.
+	StopOnCycle bool
+
+	// History is the number of turns that a paused run can be stepped back by (see Controller.Back), 100 if it
+	// is 0. The cells that changed in those turns are kept, unless the run is Headless.
+	History int
+
+	// Resume is the path of a checkpoint to start the run from instead of Input. The size, rule, topology
+	// and unboundedness of the world are taken from the checkpoint (see ResumeParams), and every event
+	// carries on counting turns from the turn it was saved on, until Turns turns have been completed.
+	Resume string
+}
+
+// Engine is an algorithm that progresses the world.
+type Engine int
+
+const (
+	// Parallel splits the world into strips (or tiles, in an unbounded universe) that are progressed
+	// one turn at a time by Threads goroutines.
+	Parallel Engine = iota
+	// HashLife memoises how the squares of the world evolve in a quadtree, and leaps ahead by a number of
+	// turns that doubles after every leap. Events are only sent at the end of each leap.
+	HashLife
+)
+
+// engineNames are the names used by String and ParseEngine.
+var engineNames = map[Engine]string{
+	Parallel: "parallel",
+	HashLife: "hashlife",
+}
+
+func (e Engine) String() string {
+	if name, ok := engineNames[e]; ok {
+		return name
+	}
+	return "Incorrect Engine"
+}
+
+// ParseEngine returns the Engine with the given name: parallel or hashlife.
+func ParseEngine(name string) (Engine, error) {
+	for e, n := range engineNames {
+		if n == name {
+			return e, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown engine %q: expected parallel or hashlife", name)
 }
 
+// inputFormats are the extensions of the files that can be loaded: Netpbm images and RLE patterns.
+var inputFormats = map[string]bool{".pgm": true, ".pbm": true, ".pnm": true, ".rle": true}
+
 // Run starts the processing of Game of Life. It should initialise channels and goroutines.
-func Run(p Params, events chan<- Event, keyPresses <-chan rune) {
+// Each key sent down keyPresses is pressed on the Controller of the run (see Controller.Press), and Run
+// returns once the run has finished.
+// If the params are invalid or the input can't be read, Run closes events and returns an error without starting.
+func Run(p Params, events chan<- Event, keyPresses <-chan rune) error {
+	c, err := Start(context.Background(), p, events)
+	if err != nil {
+		return err
+	}
+	go c.pressKeys(keyPresses)
+	return c.Wait()
+}
+
+// Start starts a run of the Game of Life in the background, and returns a Controller for it. The run quits
+// as it would with Controller.Quit once ctx is cancelled.
+// If the params are invalid, Start closes events and returns an error without starting. If the input
+// can't be read, the run closes events and finishes with an error.
+func Start(ctx context.Context, p Params, events chan<- Event) (*Controller, error) {
+	var err error
+	var resume *checkpoint
+	if p.Resume != "" {
+		var c checkpoint
+		if c, err = readCheckpoint(p.Resume); err == nil {
+			p, resume = c.resume(p), &c
+		}
+	}
+	if err == nil && p.Rule == "" && filepath.Ext(p.Input) == ".rle" {
+		p.Rule, err = readRleRule(p.Input)
+	}
+	var r rule
+	if err == nil {
+		r, err = parseRule(p.Rule)
+	}
+	switch {
+	case err != nil:
+	case p.Input != "" && !inputFormats[filepath.Ext(p.Input)]:
+		err = fmt.Errorf("unknown input format %q: expected a .pgm, .pbm, .pnm or .rle file", p.Input)
+	case p.OutputFormat != "" && p.OutputFormat != "pgm" && p.OutputFormat != "rle":
+		err = fmt.Errorf("unknown output format %q: expected pgm or rle", p.OutputFormat)
+	case r.larger() && (p.ImageWidth <= 2*r.radius || p.ImageHeight <= 2*r.radius):
+		err = fmt.Errorf("rule %v: the neighbourhood doesn't fit in a %dx%d image", r, p.ImageWidth, p.ImageHeight)
+	case p.Topology < Torus || p.Topology > CrossSurface:
+		err = fmt.Errorf("unknown topology %d", p.Topology)
+	case r.larger() && p.Topology == CrossSurface:
+		err = fmt.Errorf("rule %v: Larger than Life rules can't be run on a cross-surface", r)
+	case p.Unbounded && p.Topology != Torus:
+		err = fmt.Errorf("an unbounded universe has no edges to join into a %v", p.Topology)
+	case p.Unbounded && (r.states > 2 || r.larger()):
+		err = fmt.Errorf("rule %v: an unbounded universe only supports life-like rules", r)
+	case p.Unbounded && r.birth&1 != 0:
+		err = fmt.Errorf("rule %v: births without neighbours would fill an unbounded universe", r)
+	case p.Engine < Parallel || p.Engine > HashLife:
+		err = fmt.Errorf("unknown engine %d", p.Engine)
+	case p.Engine == HashLife && (r.states > 2 || r.larger() || r.birth&1 != 0):
+		err = fmt.Errorf("rule %v: HashLife only supports life-like rules without B0", r)
+	case p.Engine == HashLife && !p.Unbounded && p.Topology != Torus:
+		err = fmt.Errorf("HashLife can't run on a %v, only on a torus or an unbounded universe", p.Topology)
+	case p.Engine == HashLife && !p.Unbounded &&
+		(p.ImageWidth != p.ImageHeight || p.ImageWidth < 4 || p.ImageWidth&(p.ImageWidth-1) != 0):
+		err = fmt.Errorf("HashLife can only run on a square torus whose size is a power of two, not %dx%d", p.ImageWidth, p.ImageHeight)
+	case p.HashLifeMemory < 0:
+		err = fmt.Errorf("invalid HashLife memory ceiling %dMB", p.HashLifeMemory)
+	case p.Broker != "" && (p.Engine != Parallel || p.Unbounded):
+		err = fmt.Errorf("a broker can only run the parallel engine in a bounded world")
+	case p.Broker != "" && (r.larger() || p.Topology == CrossSurface):
+		err = fmt.Errorf("rule %v on a %v: distributed workers only exchange single halo rows", r, p.Topology)
+	case p.FastForward < 0:
+		err = fmt.Errorf("invalid number of turns to fast forward by %d", p.FastForward)
+	case p.History < 0:
+		err = fmt.Errorf("invalid number of turns of history %d", p.History)
+	case p.CheckpointInterval < 0:
+		err = fmt.Errorf("invalid checkpoint interval %v", p.CheckpointInterval)
+	case p.CheckpointDir != "":
+		err = os.MkdirAll(p.CheckpointDir, 0755)
+	}
+	if err != nil {
+		close(events)
+		return nil, err
+	}
 
 	//	TODO: Put the missing channels in here.
 
 	ioFilename := make(chan string)
+	ioBounds := make(chan imageBounds)
+	ioErrors := make(chan error)
 	ioCommand := make(chan ioCommand)
 	ioIdle := make(chan bool)
 	ioOutput := make(chan byte)
@@ -23,18 +219,34 @@ func Run(p Params, events chan<- Event, keyPresses <-chan rune) {
 		command:  ioCommand,
 		idle:     ioIdle,
 		filename: ioFilename,
+		bounds:   ioBounds,
+		errors:   ioErrors,
 		output:   ioOutput,
 		input:    ioInput,
 	}
-	go startIo(p, ioChannels)
+	go startIo(p, r, ioChannels)
 
 	distributorChannels := distributorChannels{
 		events:     events,
 		ioCommand:  ioCommand,
 		ioIdle:     ioIdle,
 		ioFilename: ioFilename,
+		ioBounds:   ioBounds,
+		ioErrors:   ioErrors,
 		ioOutput:   ioOutput,
 		ioInput:    ioInput,
 	}
-	distributor(p, distributorChannels, keyPresses)
+	commands := make(chan command)
+	c := newController(commands, p)
+	go func() {
+		c.finish(distributor(p, r, resume, distributorChannels, commands))
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Quit()
+		case <-c.done:
+		}
+	}()
+	return c, nil
 }
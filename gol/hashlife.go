@@ -0,0 +1,434 @@
+package gol
+
+import (
+	"math/bits"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// defaultHashLifeMemory is the memory ceiling of the node cache, in megabytes, when Params.HashLifeMemory is 0.
+const defaultHashLifeMemory = 1024
+
+// nodeBytes is roughly how much memory each node takes up, including its entry in the cache.
+const nodeBytes = 128
+
+// node is a square of 2^level x 2^level cells in a HashLife quadtree, made of four nodes of the level below
+// (or a single cell at level 0). Nodes are canonical, so two nodes with the same cells are the same node
+// (as long as neither has been collected from the cache), and immutable apart from their memoised successor.
+type node struct {
+	nw, ne, sw, se *node
+	level          int
+	population     int
+
+	next      *node // the centre of the node advanced by 2^nextSpeed turns, nil if it hasn't been calculated
+	nextSpeed int
+	epoch     int // the last collection that found the node reachable
+}
+
+// quad is the key a node is cached under.
+type quad struct {
+	nw, ne, sw, se *node
+}
+
+// hashLife is the HashLife engine. It progresses the world by up to 2^speed turns at a time, doubling the
+// speed after every leap, by memoising the successors of every node it meets: regular patterns are made
+// of the same few nodes, so it rarely calculates anything twice.
+//
+// A bounded world is a torus whose size is a power of two, which is progressed by tiling copies of it
+// into a larger node. An unbounded world is centred on the origin, and expanded with empty nodes before
+// every leap so that nothing can leave it.
+type hashLife struct {
+	rule      rule
+	unbounded bool
+	root      *node
+	speed     int
+
+	dead, alive *node
+	empties     []*node // the empty node of each level
+	cache       map[quad]*node
+	maxNodes    int
+	collectAt   int     // the cache size that triggers the next collection, at least maxNodes
+	collections int     // the number of collections so far
+	working     []*node // the nodes whose successors are being calculated, which collections must keep
+	epoch       int
+
+	flipped []util.Cell // the cells flipped since the distributor last took them
+}
+
+// newHashLife returns a HashLife engine for world, whose top left cell is (x, y) in an unbounded universe.
+// memory is the ceiling of the node cache in megabytes.
+func newHashLife(world *board, x, y int, r rule, unbounded bool, memory int) *hashLife {
+	if memory == 0 {
+		memory = defaultHashLifeMemory
+	}
+	h := &hashLife{
+		rule:      r,
+		unbounded: unbounded,
+		dead:      &node{},
+		alive:     &node{population: 1},
+		cache:     make(map[quad]*node),
+		maxNodes:  memory << 20 / nodeBytes,
+	}
+	h.collectAt = h.maxNodes
+	h.empties = []*node{h.dead}
+
+	size := world.width
+	if world.height > size {
+		size = world.height
+	}
+	if !unbounded {
+		h.root = h.build(world, 0, 0, bits.Len(uint(size-1)))
+		return h
+	}
+
+	//An unbounded world is centred on the origin, so it needs to reach as far from it in every direction as
+	//the image does in any
+	extent := 1
+	for _, d := range []int{size, -x, x + world.width, -y, y + world.height} {
+		if d > extent {
+			extent = d
+		}
+	}
+	level := bits.Len(uint(extent - 1))
+	if level < 2 {
+		level = 2
+	}
+	half := 1 << uint(level)
+	h.root = h.build(world, -half-x, -half-y, level+1)
+	return h
+}
+
+// build returns the node of the given level whose top left cell is cell (x, y) of world.
+// Cells outside world are dead.
+func (h *hashLife) build(world *board, x, y, level int) *node {
+	size := 1 << uint(level)
+	if x >= world.width || y >= world.height || x+size <= 0 || y+size <= 0 {
+		return h.empty(level)
+	}
+	if level == 0 {
+		if world.get(x, y) {
+			return h.alive
+		}
+		return h.dead
+	}
+	half := size / 2
+	return h.join(
+		h.build(world, x, y, level-1), h.build(world, x+half, y, level-1),
+		h.build(world, x, y+half, level-1), h.build(world, x+half, y+half, level-1))
+}
+
+// join returns the canonical node made of four nodes of the same level.
+func (h *hashLife) join(nw, ne, sw, se *node) *node {
+	key := quad{nw, ne, sw, se}
+	if n, ok := h.cache[key]; ok {
+		return n
+	}
+	n := &node{
+		nw: nw, ne: ne, sw: sw, se: se,
+		level:      nw.level + 1,
+		population: nw.population + ne.population + sw.population + se.population,
+	}
+	h.cache[key] = n
+	return n
+}
+
+// empty returns the node of the given level with no alive cells.
+func (h *hashLife) empty(level int) *node {
+	for len(h.empties) <= level {
+		e := h.empties[len(h.empties)-1]
+		h.empties = append(h.empties, h.join(e, e, e, e))
+	}
+	return h.empties[level]
+}
+
+// centre returns the node of the level below made of the middle cells of n.
+func (h *hashLife) centre(n *node) *node {
+	return h.join(n.nw.se, n.ne.sw, n.sw.ne, n.se.nw)
+}
+
+// expand returns the node of the level above with n in its middle and dead cells around it.
+func (h *hashLife) expand(n *node) *node {
+	e := h.empty(n.level - 1)
+	return h.join(h.join(e, e, e, n.nw), h.join(e, e, n.ne, e), h.join(e, n.sw, e, e), h.join(n.se, e, e, e))
+}
+
+// successor returns the centre of n advanced by 2^speed turns, where n is at least level 2 and speed is at
+// most its level-2. This is as far as the cells of the centre can be calculated from n alone.
+func (h *hashLife) successor(n *node, speed int) *node {
+	switch {
+	case n.population == 0:
+		//Rules without B0 can't bring an empty area to life
+		return h.empty(n.level - 1)
+	case n.next != nil && n.nextSpeed == speed:
+		return n.next
+	case n.level == 2:
+		n.next, n.nextSpeed = h.base(n), speed
+		return n.next
+	}
+
+	//The cache grows fastest within a leap, so this is where its ceiling is enforced
+	h.working = append(h.working, n)
+	if len(h.cache) > h.collectAt {
+		h.collect()
+	}
+
+	//The nine overlapping nodes of the level below centred on the corners, edges and middle of n
+	n00, n01, n02 := n.nw, h.join(n.nw.ne, n.ne.nw, n.nw.se, n.ne.sw), n.ne
+	n10, n11, n12 := h.join(n.nw.sw, n.nw.se, n.sw.nw, n.sw.ne), h.centre(n), h.join(n.ne.sw, n.ne.se, n.se.nw, n.se.ne)
+	n20, n21, n22 := n.sw, h.join(n.sw.ne, n.se.nw, n.sw.se, n.se.sw), n.se
+
+	//At full speed they are advanced by half the turns, and the four squares they make up by the other half.
+	//Otherwise only the four squares are advanced, by all of the turns.
+	first := func(m *node) *node { return h.successor(m, speed-1) }
+	second := func(m *node) *node { return h.successor(m, speed-1) }
+	if speed < n.level-2 {
+		first = h.centre
+		second = func(m *node) *node { return h.successor(m, speed) }
+	}
+	a00, a01, a02 := first(n00), first(n01), first(n02)
+	a10, a11, a12 := first(n10), first(n11), first(n12)
+	a20, a21, a22 := first(n20), first(n21), first(n22)
+	n.next = h.join(
+		second(h.join(a00, a01, a10, a11)), second(h.join(a01, a02, a11, a12)),
+		second(h.join(a10, a11, a20, a21)), second(h.join(a11, a12, a21, a22)))
+	n.nextSpeed = speed
+	h.working = h.working[:len(h.working)-1]
+	return n.next
+}
+
+// base advances the middle 2x2 cells of a level 2 node by one turn.
+func (h *hashLife) base(n *node) *node {
+	//Bit 4y+x of cells is cell (x, y) of the 4x4 node
+	var cells uint16
+	for i, quadrant := range [4]*node{n.nw, n.ne, n.sw, n.se} {
+		for j, cell := range [4]*node{quadrant.nw, quadrant.ne, quadrant.sw, quadrant.se} {
+			if cell.population != 0 {
+				x, y := i%2*2+j%2, i/2*2+j/2
+				cells |= 1 << uint(4*y+x)
+			}
+		}
+	}
+	var next [4]*node
+	for j := range next {
+		x, y := 1+j%2, 1+j/2
+		count := 0
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				if (dx != 0 || dy != 0) && cells&(1<<uint(4*(y+dy)+x+dx)) != 0 {
+					count++
+				}
+			}
+		}
+		counts := h.rule.birth
+		if cells&(1<<uint(4*y+x)) != 0 {
+			counts = h.rule.survival
+		}
+		next[j] = h.dead
+		if counts&(1<<uint(count)) != 0 {
+			next[j] = h.alive
+		}
+	}
+	return h.join(next[0], next[1], next[2], next[3])
+}
+
+// step progresses the world by a single turn.
+func (h *hashLife) step(turn int) {
+	speed := h.speed
+	h.speed = 0
+	h.leap(turn, 1)
+	h.speed = speed
+}
+
+// leap progresses the world by 2^speed turns, or the largest power of two up to turns, and returns how many
+// that was. Flipped cells are only sent for the differences between the world before and after the leap.
+// Nodes are collected whenever the cache outgrows its memory ceiling, including part way through a leap.
+func (h *hashLife) leap(turn, turns int) int {
+	speed := h.speed
+	for 1<<uint(speed) > turns {
+		speed--
+	}
+
+	old := h.root
+	if !h.unbounded {
+		//A node tiled with 2^tiles x 2^tiles copies of the torus is big enough to advance the torus by 2^speed turns
+		tiles := speed + 2 - old.level
+		if tiles < 1 {
+			tiles = 1
+		}
+		tiled := old
+		for i := 0; i < tiles; i++ {
+			tiled = h.join(tiled, tiled, tiled, tiled)
+		}
+
+		//The successor is the middle of the tiling, which is offset from the torus by a quarter of its size
+		next := h.successor(tiled, speed)
+		if tiles == 1 {
+			next = h.join(next.se, next.sw, next.ne, next.nw)
+		}
+		for next.level > old.level {
+			next = next.nw
+		}
+		h.root = next
+	} else {
+		//Cells move at most one cell per turn, so keeping them in the middle quarter stops them leaving the successor
+		for h.root.level < speed+3 || h.centre(h.centre(h.root)).population != h.root.population {
+			h.root = h.expand(h.root)
+		}
+		old = h.root
+		h.root = h.successor(h.root, speed)
+		for h.root.level > 3 && h.centre(h.root).population == h.root.population {
+			h.root = h.centre(h.root)
+		}
+	}
+
+	//Both roots are centred on the origin in an unbounded world, so they line up once they are the same size
+	next := h.root
+	for next.level < old.level {
+		next = h.expand(next)
+	}
+	x, y := h.origin(old)
+	h.diff(old, next, x, y)
+
+	h.speed = speed + 1
+	if len(h.cache) > h.collectAt {
+		h.collect()
+	}
+	return 1 << uint(speed)
+}
+
+// origin returns the coordinates of the top left cell of a root node.
+func (h *hashLife) origin(root *node) (int, int) {
+	if !h.unbounded {
+		return 0, 0
+	}
+	half := 1 << uint(root.level-1)
+	return -half, -half
+}
+
+// diff keeps every cell that differs between two nodes of the same level as flipped, whose top left cell
+// is (x, y). Identical nodes are skipped without looking at their cells.
+func (h *hashLife) diff(a, b *node, x, y int) {
+	switch {
+	case a == b:
+	case a.level == 0:
+		if a.population != b.population {
+			h.flipped = append(h.flipped, util.Cell{X: x, Y: y})
+		}
+	default:
+		half := 1 << uint(a.level-1)
+		h.diff(a.nw, b.nw, x, y)
+		h.diff(a.ne, b.ne, x+half, y)
+		h.diff(a.sw, b.sw, x, y+half)
+		h.diff(a.se, b.se, x+half, y+half)
+	}
+}
+
+// changes returns the cells flipped since it was last called. HashLife only supports two states.
+func (h *hashLife) changes() delta {
+	d := delta{flipped: h.flipped}
+	h.flipped = nil
+	return d
+}
+
+// collect removes the nodes that aren't part of the world, or of a successor being calculated, from the
+// cache, along with the successors that refer to them, so that the garbage collector can free them.
+// Intermediate results of the successors being calculated may be collected too, which only means that
+// their nodes are no longer shared with identical nodes made later.
+//
+// If the nodes that are kept still fill most of the cache, the next collection waits until the cache has
+// doubled in size, rather than running again straight away and forgetting every successor each time.
+func (h *hashLife) collect() {
+	h.collections++
+	h.epoch++
+	h.mark(h.root)
+	for _, n := range h.working {
+		h.mark(n)
+	}
+	for _, e := range h.empties {
+		e.epoch = h.epoch
+	}
+	for key, n := range h.cache {
+		switch {
+		case n.epoch != h.epoch:
+			delete(h.cache, key)
+		case n.next != nil && n.next.epoch != h.epoch:
+			n.next = nil
+		}
+	}
+	h.collectAt = h.maxNodes
+	if 2*len(h.cache) > h.maxNodes {
+		h.collectAt = 2 * len(h.cache)
+	}
+}
+
+func (h *hashLife) mark(n *node) {
+	if n.level == 0 || n.epoch == h.epoch {
+		return
+	}
+	n.epoch = h.epoch
+	h.mark(n.nw)
+	h.mark(n.ne)
+	h.mark(n.sw)
+	h.mark(n.se)
+}
+
+// cells calls f with the coordinates of every alive cell of n, whose top left cell is (x, y).
+func (h *hashLife) cells(n *node, x, y int, f func(x, y int)) {
+	switch {
+	case n.population == 0:
+	case n.level == 0:
+		f(x, y)
+	default:
+		half := 1 << uint(n.level-1)
+		h.cells(n.nw, x, y, f)
+		h.cells(n.ne, x+half, y, f)
+		h.cells(n.sw, x, y+half, f)
+		h.cells(n.se, x+half, y+half, f)
+	}
+}
+
+// aliveCount returns the number of alive cells in the world.
+func (h *hashLife) aliveCount() int {
+	return h.root.population
+}
+
+// snapshot copies the world into a board: the whole torus, or the bounding box of the alive cells in an
+// unbounded world.
+func (h *hashLife) snapshot() (*board, int, int) {
+	x, y := h.origin(h.root)
+	if !h.unbounded {
+		size := 1 << uint(h.root.level)
+		world := newBoard(size, size, 2)
+		h.cells(h.root, x, y, func(x, y int) { world.set(x, y, true) })
+		return world, 0, 0
+	}
+
+	var alive []util.Cell
+	h.cells(h.root, x, y, func(x, y int) { alive = append(alive, util.Cell{X: x, Y: y}) })
+	if len(alive) == 0 {
+		return newBoard(0, 0, 2), 0, 0
+	}
+	minX, minY, maxX, maxY := alive[0].X, alive[0].Y, alive[0].X, alive[0].Y
+	for _, cell := range alive {
+		if cell.X < minX {
+			minX = cell.X
+		}
+		if cell.X > maxX {
+			maxX = cell.X
+		}
+		if cell.Y < minY {
+			minY = cell.Y
+		}
+		if cell.Y > maxY {
+			maxY = cell.Y
+		}
+	}
+	world := newBoard(maxX-minX+1, maxY-minY+1, 2)
+	for _, cell := range alive {
+		world.set(cell.X-minX, cell.Y-minY, true)
+	}
+	return world, minX, minY
+}
+
+// stop does nothing, as HashLife runs on the distributor goroutine.
+func (h *hashLife) stop() {}
@@ -0,0 +1,50 @@
+package gol
+
+import "testing"
+
+// TestHashLifeCacheCeiling checks that a single leap under a low memory ceiling collects the node cache as
+// it goes, keeping it close to the ceiling, and gets the same result as a leap with the default ceiling.
+func TestHashLifeCacheCeiling(t *testing.T) {
+	r, err := parseRule("B3/S23")
+	if err != nil {
+		t.Fatal(err)
+	}
+	world := newBoard(128, 128, 2)
+	seed := uint32(1)
+	for y := 0; y < world.height; y++ {
+		for x := 0; x < world.width; x++ {
+			seed = seed*1664525 + 1013904223
+			world.set(x, y, seed>>29 < 3)
+		}
+	}
+
+	limited := newHashLife(world, 0, 0, r, false, 0)
+	limited.maxNodes, limited.collectAt = 20000, 20000
+	unlimited := newHashLife(world, 0, 0, r, false, 0)
+	for _, h := range []*hashLife{limited, unlimited} {
+		h.speed = 10
+		h.leap(0, 1<<10)
+	}
+
+	if limited.collections < 2 {
+		t.Errorf("expected the cache to be collected during the leap, but it was collected %d times", limited.collections)
+	}
+	//Only a few nodes are made between the checks in successor
+	if len(limited.cache) > limited.collectAt+64 {
+		t.Errorf("the cache holds %d nodes, but should be collected at %d", len(limited.cache), limited.collectAt)
+	}
+	if limited.collectAt > 2*limited.maxNodes {
+		t.Errorf("the cache is only collected at %d nodes, for a ceiling of %d", limited.collectAt, limited.maxNodes)
+	}
+	a, _, _ := limited.snapshot()
+	b, _, _ := unlimited.snapshot()
+	aliveA, aliveB := a.aliveCells(), b.aliveCells()
+	if len(aliveA) != len(aliveB) {
+		t.Fatalf("%d alive cells under the ceiling, %d without it", len(aliveA), len(aliveB))
+	}
+	for i, cell := range aliveA {
+		if aliveB[i] != cell {
+			t.Fatalf("cell %v differs under the ceiling", cell)
+		}
+	}
+}
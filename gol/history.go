@@ -0,0 +1,120 @@
+package gol
+
+import "uk.ac.bris.cs/gameoflife/util"
+
+// defaultHistory is the number of turns that a paused run can be stepped back by if Params.History is 0.
+const defaultHistory = 100
+
+// maxHistoryCells is the most changed cells that the history of a run holds, beyond which its oldest turns
+// are forgotten even if it holds fewer than Params.History of them, as every cell of a busy world can change
+// in a single turn.
+const maxHistoryCells = 1 << 22
+
+// delta is the change to the world from turn to the next turn completed, which is more than a turn later
+// after a HashLife leap: the cells that flipped, and under Generations rules every cell that changed state
+// along with the state it changed to.
+type delta struct {
+	turn    int
+	flipped []util.Cell
+	changed []util.Cell
+	states  []uint8
+}
+
+// history is a ring buffer of the deltas of the latest turns of a run, made of the same cells that the
+// distributor sends CellsFlipped and CellStateChanged events for.
+type history struct {
+	deltas        []delta
+	start, length int
+	cells         int
+}
+
+func newHistory(turns int) *history {
+	return &history{deltas: make([]delta, turns)}
+}
+
+// add adds the delta of a turn, forgetting the oldest turns if the history is full.
+func (h *history) add(d delta) {
+	if h.length == len(h.deltas) {
+		h.forget()
+	}
+	h.deltas[(h.start+h.length)%len(h.deltas)] = d
+	h.length++
+	h.cells += len(d.flipped) + len(d.changed)
+	for h.cells > maxHistoryCells && h.length > 0 {
+		h.forget()
+	}
+}
+
+// forget drops the oldest delta.
+func (h *history) forget() {
+	oldest := &h.deltas[h.start]
+	h.cells -= len(oldest.flipped) + len(oldest.changed)
+	*oldest = delta{}
+	h.start = (h.start + 1) % len(h.deltas)
+	h.length--
+}
+
+// pop removes the latest delta, and reports whether there was one.
+func (h *history) pop() (delta, bool) {
+	if h.length == 0 {
+		return delta{}, false
+	}
+	h.length--
+	latest := &h.deltas[(h.start+h.length)%len(h.deltas)]
+	d := *latest
+	*latest = delta{}
+	h.cells -= len(d.flipped) + len(d.changed)
+	return d, true
+}
+
+// undo returns the world before the delta from world, whose top left cell is (x, y), and the coordinates
+// of its top left cell. In an unbounded universe the world grows to fit the cells that are brought back.
+func (d delta) undo(world *board, x, y, states int) (*board, int, int) {
+	minX, minY, maxX, maxY := x, y, x+world.width, y+world.height
+	for _, cell := range d.flipped {
+		if cell.X < minX {
+			minX = cell.X
+		}
+		if cell.Y < minY {
+			minY = cell.Y
+		}
+		if cell.X >= maxX {
+			maxX = cell.X + 1
+		}
+		if cell.Y >= maxY {
+			maxY = cell.Y + 1
+		}
+	}
+	if minX != x || minY != y || maxX != x+world.width || maxY != y+world.height {
+		//Only two-state worlds are unbounded
+		grown := newBoard(maxX-minX, maxY-minY, states)
+		for _, cell := range world.aliveCells() {
+			grown.set(cell.X+x-minX, cell.Y+y-minY, true)
+		}
+		world, x, y = grown, minX, minY
+	}
+
+	if states > 2 {
+		for i, cell := range d.changed {
+			world.setState(cell.X-x, cell.Y-y, previousState(d.states[i], states))
+		}
+	} else {
+		for _, cell := range d.flipped {
+			world.set(cell.X-x, cell.Y-y, !world.get(cell.X-x, cell.Y-y))
+		}
+	}
+	return world, x, y
+}
+
+// previousState returns the state of a cell the turn before it changed to state under a Generations rule:
+// cells are born when dead, start dying once they are alive, and decay a state every turn until dead.
+func previousState(state uint8, states int) uint8 {
+	switch state {
+	case dead:
+		return uint8(states - 1)
+	case alive:
+		return dead
+	default:
+		return state - 1
+	}
+}
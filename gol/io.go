@@ -1,9 +1,10 @@
 package gol
 
 import (
+	"bufio"
 	"fmt"
-	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"uk.ac.bris.cs/gameoflife/util"
@@ -14,6 +15,8 @@ type ioChannels struct {
 	idle    chan<- bool
 
 	filename <-chan string
+	bounds   <-chan imageBounds
+	errors   chan<- error
 	output   <-chan uint8
 	input    chan<- uint8
 }
@@ -21,9 +24,18 @@ type ioChannels struct {
 // ioState is the internal ioState of the io goroutine.
 type ioState struct {
 	params   Params
+	rule     rule
+	states   int
 	channels ioChannels
 }
 
+// imageBounds is the size of an image being output and the position of its top left cell, which are
+// only different from the params in an unbounded universe.
+type imageBounds struct {
+	x, y          int
+	width, height int
+}
+
 // ioCommand allows requesting behaviour from the io (pgm) goroutine.
 type ioCommand uint8
 
@@ -38,34 +50,67 @@ const (
 	ioCheckIdle
 )
 
-// writePgmImage receives an array of bytes and writes it to a pgm file.
-func (io *ioState) writePgmImage() {
-	_ = os.Mkdir("out", os.ModePerm)
+// aliveThreshold is the grey level from which cells are alive under two-state rules.
+const aliveThreshold = 128
+
+// greyLevel maps a cell state to the grey level it is stored as in a pgm file.
+// Dead cells are black, alive cells are white and dying cells fade from white to black.
+func greyLevel(state uint8, states int) uint8 {
+	switch state {
+	case dead:
+		return 0
+	case alive:
+		return 255
+	default:
+		return uint8(255 * (states - int(state)) / (states - 1))
+	}
+}
+
+// cellState maps a grey level from a pgm file back to the nearest cell state.
+// Under two-state rules, cells at least as bright as aliveThreshold are alive.
+func cellState(grey uint8, states int) uint8 {
+	switch {
+	case grey == 255 || (states <= 2 && grey >= aliveThreshold):
+		return alive
+	case grey == 0 || states <= 2:
+		return dead
+	}
+	state := states - (int(grey)*(states-1)+127)/255
+	if state < 2 {
+		state = 2
+	} else if state > states-1 {
+		state = states - 1
+	}
+	return uint8(state)
+}
 
-	// Request a filename from the distributor.
-	filename := <-io.channels.filename
+// writePgmImage receives cell states and writes them to a pgm file as grey levels.
+func (io *ioState) writePgmImage(path string) {
+	_ = os.MkdirAll(filepath.Dir(path), os.ModePerm)
 
-	file, ioError := os.Create("out/" + filename + ".pgm")
+	size := <-io.channels.bounds
+
+	file, ioError := os.Create(path)
 	util.Check(ioError)
 	defer file.Close()
 
 	_, _ = file.WriteString("P5\n")
 	//_, _ = file.WriteString("# PGM file writer by pnmmodules (https://github.com/owainkenwayucl/pnmmodules).\n")
-	_, _ = file.WriteString(strconv.Itoa(io.params.ImageWidth))
+	_, _ = file.WriteString(strconv.Itoa(size.width))
 	_, _ = file.WriteString(" ")
-	_, _ = file.WriteString(strconv.Itoa(io.params.ImageHeight))
+	_, _ = file.WriteString(strconv.Itoa(size.height))
 	_, _ = file.WriteString("\n")
 	_, _ = file.WriteString(strconv.Itoa(255))
 	_, _ = file.WriteString("\n")
 
-	world := make([][]byte, io.params.ImageHeight)
+	world := make([][]byte, size.height)
 	for i := range world {
-		world[i] = make([]byte, io.params.ImageWidth)
+		world[i] = make([]byte, size.width)
 	}
 
-	for y := 0; y < io.params.ImageHeight; y++ {
-		for x := 0; x < io.params.ImageWidth; x++ {
-			val := <-io.channels.output
+	for y := 0; y < size.height; y++ {
+		for x := 0; x < size.width; x++ {
+			val := greyLevel(<-io.channels.output, io.states)
 			//if val != 0 {
 			//	fmt.Println(x, y)
 			//}
@@ -73,8 +118,8 @@ func (io *ioState) writePgmImage() {
 		}
 	}
 
-	for y := 0; y < io.params.ImageHeight; y++ {
-		for x := 0; x < io.params.ImageWidth; x++ {
+	for y := 0; y < size.height; y++ {
+		for x := 0; x < size.width; x++ {
 			_, ioError = file.Write([]byte{world[y][x]})
 			util.Check(ioError)
 		}
@@ -83,52 +128,44 @@ func (io *ioState) writePgmImage() {
 	ioError = file.Sync()
 	util.Check(ioError)
 
-	fmt.Println("File", filename, "output done!")
+	fmt.Println("File", fileTitle(path), "output done!")
 }
 
-// readPgmImage opens a pgm file and sends its data as an array of bytes.
-func (io *ioState) readPgmImage() {
-
-	// Request a filename from the distributor.
-	filename := <-io.channels.filename
-
-	data, ioError := ioutil.ReadFile("images/" + filename + ".pgm")
-	util.Check(ioError)
-
-	fields := strings.Fields(string(data))
-
-	if fields[0] != "P5" {
-		panic("Not a pgm file")
-	}
-
-	width, _ := strconv.Atoi(fields[1])
-	if width != io.params.ImageWidth {
-		panic("Incorrect width")
+// readPgmImage opens a Netpbm (pgm or pbm) file and returns its pixels as cell states.
+func (io *ioState) readPgmImage(path string) ([]uint8, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
 	}
+	defer file.Close()
 
-	height, _ := strconv.Atoi(fields[2])
-	if height != io.params.ImageHeight {
-		panic("Incorrect height")
+	image, err := readNetpbm(bufio.NewReader(file))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
 	}
-
-	maxval, _ := strconv.Atoi(fields[3])
-	if maxval != 255 {
-		panic("Incorrect maxval/bit depth")
+	if image.width != io.params.ImageWidth || image.height != io.params.ImageHeight {
+		return nil, fmt.Errorf("%s: the image is %dx%d, not %dx%d",
+			path, image.width, image.height, io.params.ImageWidth, io.params.ImageHeight)
 	}
 
-	image := []byte(fields[4])
-
-	for _, b := range image {
-		io.channels.input <- b
+	states := make([]uint8, len(image.grey))
+	for i, grey := range image.grey {
+		states[i] = cellState(grey, io.states)
 	}
+	return states, nil
+}
 
-	fmt.Println("File", filename, "input done!")
+// fileTitle returns the name of the file at path, without its directory or extension.
+func fileTitle(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
 }
 
 // startIo should be the entrypoint of the io goroutine.
-func startIo(p Params, c ioChannels) {
+func startIo(p Params, r rule, c ioChannels) {
 	io := ioState{
 		params:   p,
+		rule:     r,
+		states:   r.states,
 		channels: c,
 	}
 
@@ -137,10 +174,32 @@ func startIo(p Params, c ioChannels) {
 		// Block and wait for requests from the distributor
 		case command := <-io.channels.command:
 			switch command {
+			// Request a path from the distributor, whose extension is the format of the file.
 			case ioInput:
-				io.readPgmImage()
+				path := <-io.channels.filename
+				var states []uint8
+				var err error
+				if filepath.Ext(path) == ".rle" {
+					states, err = io.readRleImage(path)
+				} else {
+					states, err = io.readPgmImage(path)
+				}
+
+				//The distributor only waits for the cells if the file could be read
+				io.channels.errors <- err
+				if err == nil {
+					for _, state := range states {
+						io.channels.input <- state
+					}
+					fmt.Println("File", fileTitle(path), "input done!")
+				}
 			case ioOutput:
-				io.writePgmImage()
+				path := <-io.channels.filename
+				if filepath.Ext(path) == ".rle" {
+					io.writeRleImage(path)
+				} else {
+					io.writePgmImage(path)
+				}
 			case ioCheckIdle:
 				io.channels.idle <- true
 			}
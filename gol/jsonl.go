@@ -0,0 +1,114 @@
+package gol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// eventNames are the types of event that can be encoded, by the name each is encoded with.
+var eventNames = make(map[string]reflect.Type)
+
+func init() {
+	for _, event := range eventTypes {
+		t := reflect.TypeOf(event)
+		eventNames[t.Name()] = t
+	}
+}
+
+// EventEncoder writes events as JSON Lines: a JSON object on each line with the name of the type of the
+// event as Type, followed by its fields, such as
+//
+//	{"Type":"AliveCellsCount","CompletedTurns":100,"CellsCount":42}
+type EventEncoder struct {
+	w io.Writer
+}
+
+// NewEventEncoder returns an EventEncoder that writes to w.
+func NewEventEncoder(w io.Writer) *EventEncoder {
+	return &EventEncoder{w: w}
+}
+
+// Encode writes an event as a line of JSON, in a single write so that it isn't split by other writes to
+// the same file, such as standard output.
+func (e *EventEncoder) Encode(event Event) error {
+	t := reflect.TypeOf(event)
+	if eventNames[t.Name()] != t {
+		return fmt.Errorf("events: can't encode an event of type %v", t)
+	}
+	fields, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("events: %v", err)
+	}
+	line := []byte(`{"Type":"` + t.Name() + `"`)
+	if len(fields) > 2 {
+		line = append(line, ',')
+	}
+	line = append(append(line, fields[1:]...), '\n')
+	_, err = e.w.Write(line)
+	return err
+}
+
+// EventDecoder reads events written by an EventEncoder. Lines that aren't JSON objects are skipped, so that
+// events written to standard output can be read back from everything else that was written there.
+type EventDecoder struct {
+	r    *bufio.Reader
+	line int
+}
+
+// NewEventDecoder returns an EventDecoder that reads from r.
+func NewEventDecoder(r io.Reader) *EventDecoder {
+	return &EventDecoder{r: bufio.NewReader(r)}
+}
+
+// Decode reads the next event, and returns io.EOF once there are none left.
+func (d *EventDecoder) Decode() (Event, error) {
+	for {
+		line, err := d.r.ReadBytes('\n')
+		if err == io.EOF && len(line) > 0 {
+			err = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		d.line++
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var header struct{ Type string }
+		if err := json.Unmarshal(line, &header); err != nil {
+			return nil, fmt.Errorf("events: line %d: %v", d.line, err)
+		}
+		t, ok := eventNames[header.Type]
+		if !ok {
+			return nil, fmt.Errorf("events: line %d: unknown type of event %q", d.line, header.Type)
+		}
+		event := reflect.New(t)
+		if err := json.Unmarshal(line, event.Interface()); err != nil {
+			return nil, fmt.Errorf("events: line %d: %v", d.line, err)
+		}
+		return event.Elem().Interface().(Event), nil
+	}
+}
+
+// ReadEvents sends the events read from r down events, as they were sent by the run that they were written
+// from, and closes events once they have all been sent. It returns the error that stopped it reading, or nil
+// once every event has been read.
+func ReadEvents(r io.Reader, events chan<- Event) error {
+	defer close(events)
+	d := NewEventDecoder(r)
+	for {
+		event, err := d.Decode()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		events <- event
+	}
+}
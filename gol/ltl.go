@@ -0,0 +1,170 @@
+package gol
+
+// neighbourhoodCounter counts the alive cells in the Larger than Life neighbourhood of every cell in a strip.
+// Counting each neighbourhood naively is O(r²) per cell, so instead it builds prefix sums over the strip
+// and its halo rows once per turn: a summed-area table gives Moore counts in O(1). Von Neumann (diamond)
+// counts take O(r) from per-row prefix sums for the first cell of each row, then O(1) for each cell after it
+// from prefix sums along both diagonals, which give the cells that enter and leave the diamond as it moves
+// one cell to the right. Its tables are kept between turns to avoid reallocating them.
+type neighbourhoodCounter struct {
+	rule          rule
+	topology      Topology
+	width, height int
+	cols          int     // prefix sums per row, one more than the width of the strip plus its halo columns
+	sums          []int32 // summed-area table (Moore) or per-row prefix sums (von Neumann)
+
+	//Von Neumann only: sums along each down-right and down-left diagonal ending at every extended cell,
+	//with a row of zeros above and a column of zeros either side
+	diagonal, antidiagonal []int32
+}
+
+// newNeighbourhoodCounter returns a counter for strips of the given size.
+// Topologies that join the left and right edges with a twist aren't supported.
+func newNeighbourhoodCounter(r rule, t Topology, width, height int) *neighbourhoodCounter {
+	cols := width + 2*r.radius + 1
+	rows := height + 2*r.radius + 1
+	n := &neighbourhoodCounter{
+		rule:     r,
+		topology: t,
+		width:    width,
+		height:   height,
+		cols:     cols,
+		sums:     make([]int32, rows*cols),
+	}
+	if r.vonNeumann {
+		n.diagonal = make([]int32, rows*(cols+1))
+		n.antidiagonal = make([]int32, rows*(cols+1))
+	}
+	return n
+}
+
+// count builds the prefix sums for strip, given the radius rows above and below it (already dead or
+// reversed if they cross the top or bottom edge of the world).
+func (n *neighbourhoodCounter) count(strip *board, above, below []uint64) {
+	radius := n.rule.radius
+	stride := strip.stride
+	for j := 0; j < n.height+2*radius; j++ {
+		//Extended row j is row j-radius of the strip, which may be in one of the halos
+		var row []uint64
+		switch y := j - radius; {
+		case y < 0:
+			row = above[j*stride : (j+1)*stride]
+		case y >= n.height:
+			row = below[(y-n.height)*stride : (y-n.height+1)*stride]
+		default:
+			row = strip.row(y)
+		}
+
+		//Moore sums accumulate down the rows as well, von Neumann sums are per row
+		prefix := n.sums[(j+1)*n.cols : (j+2)*n.cols]
+		previous := n.sums[j*n.cols : (j+1)*n.cols]
+		if n.rule.vonNeumann {
+			prefix = n.sums[j*n.cols : (j+1)*n.cols]
+		}
+		var total int32
+		prefix[0] = 0
+		for k := 1; k < n.cols; k++ {
+			//Column k-1 of the extended row is column k-1-radius of the board, which may be beyond its edges
+			x := k - 1 - radius
+			inside := x >= 0 && x < n.width
+			if !inside && n.topology.wrapsHorizontally() {
+				x = (x + n.width) % n.width
+				inside = true
+			}
+			var cell int32
+			if inside && row[x/wordSize]&(1<<uint(x%wordSize)) != 0 {
+				cell = 1
+			}
+			total += cell
+			prefix[k] = total
+			if !n.rule.vonNeumann {
+				prefix[k] += previous[k]
+				continue
+			}
+			//Extended cell (j, k-1) is at index (j+1)*(cols+1)+k of the diagonal sums
+			i := (j+1)*(n.cols+1) + k
+			n.diagonal[i] = cell + n.diagonal[i-n.cols-2]
+			n.antidiagonal[i] = cell + n.antidiagonal[i-n.cols]
+		}
+	}
+}
+
+// diagonalSum returns the number of alive cells on the down-right diagonal of the extended strip from
+// (x, y) to (x+length-1, y+length-1).
+func (n *neighbourhoodCounter) diagonalSum(x, y, length int) int32 {
+	end := (y+length)*(n.cols+1) + x + length
+	return n.diagonal[end] - n.diagonal[end-length*(n.cols+2)]
+}
+
+// antidiagonalSum returns the number of alive cells on the down-left diagonal of the extended strip from
+// (x, y) to (x-length+1, y+length-1).
+func (n *neighbourhoodCounter) antidiagonalSum(x, y, length int) int32 {
+	end := (y+length)*(n.cols+1) + x - length + 2
+	return n.antidiagonal[end] - n.antidiagonal[end-length*n.cols]
+}
+
+// slide returns how the von Neumann count changes from cell (x, y) of the strip to cell (x+1, y): the
+// cells entering the diamond are on the two diagonals of its new right corner, and the cells leaving it
+// on the two diagonals of its old left corner.
+func (n *neighbourhoodCounter) slide(x, y int) int {
+	radius := n.rule.radius
+	//The diamond of cell (x, y) is centred on extended cell (x+radius, y+radius)
+	cx, cy := x+radius, y+radius
+	entering := n.diagonalSum(cx+1, cy-radius, radius+1) + n.antidiagonalSum(cx+radius, cy+1, radius)
+	leaving := n.antidiagonalSum(cx, cy-radius, radius+1) + n.diagonalSum(cx-radius+1, cy+1, radius)
+	return int(entering - leaving)
+}
+
+// at returns the number of alive cells in the neighbourhood of cell (x, y) of the strip, including the cell itself.
+// This is O(r) for von Neumann neighbourhoods, which nextRow only uses for the first cell of each row.
+func (n *neighbourhoodCounter) at(x, y int) int {
+	radius := n.rule.radius
+	if !n.rule.vonNeumann {
+		top, bottom := y*n.cols, (y+2*radius+1)*n.cols
+		left, right := x, x+2*radius+1
+		return int(n.sums[bottom+right] - n.sums[top+right] - n.sums[bottom+left] + n.sums[top+left])
+	}
+
+	count := 0
+	for dy := -radius; dy <= radius; dy++ {
+		halfWidth := radius - dy
+		if dy < 0 {
+			halfWidth = radius + dy
+		}
+		prefix := n.sums[(y+dy+radius)*n.cols:]
+		count += int(prefix[x+radius+halfWidth+1] - prefix[x+radius-halfWidth])
+	}
+	return count
+}
+
+// nextRow calculates which cells of row y of the strip are alive next turn and writes them into dst,
+// once the prefix sums have been counted. dying is the dying bit plane of the row, or nil under two-state rules.
+func (n *neighbourhoodCounter) nextRow(dst, row, dying []uint64, y int) {
+	r := n.rule
+	for i := range dst {
+		dst[i] = 0
+	}
+	neighbours := 0
+	for x := 0; x < n.width; x++ {
+		word, bit := x/wordSize, uint64(1)<<uint(x%wordSize)
+		if r.vonNeumann && x > 0 {
+			neighbours += n.slide(x-1, y)
+		} else {
+			neighbours = n.at(x, y)
+		}
+		count := neighbours
+		var next bool
+		switch {
+		case row[word]&bit != 0:
+			if !r.middle {
+				count--
+			}
+			next = r.survivalMin <= count && count <= r.survivalMax
+		case dying == nil || dying[word]&bit == 0:
+			next = r.birthMin <= count && count <= r.birthMax
+		}
+		if next {
+			dst[word] |= bit
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package gol
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// maxImageCells is the largest number of cells an image may have, so that a corrupt header can't
+// make the reader allocate more memory than it has.
+const maxImageCells = 1 << 30
+
+// netpbmImage is an image read from a Netpbm file, with every sample scaled to a grey level from 0 to 255.
+type netpbmImage struct {
+	width, height int
+	grey          []uint8 // row by row
+}
+
+// readNetpbm reads a PBM (P1 or P4) or PGM (P2 or P5) image with any maxval. Header fields may be
+// separated by any whitespace and comments, which start with # and run to the end of the line.
+// In bitmaps 1 is black, which is read as white (alive) so that patterns drawn in black come to life.
+func readNetpbm(r *bufio.Reader) (*netpbmImage, error) {
+	magic, err := netpbmToken(r)
+	if err != nil {
+		return nil, fmt.Errorf("netpbm: missing magic number: %v", err)
+	}
+	if magic != "P1" && magic != "P2" && magic != "P4" && magic != "P5" {
+		return nil, fmt.Errorf("netpbm: unsupported magic number %q: expected P1, P2, P4 or P5", magic)
+	}
+	img := &netpbmImage{}
+	if img.width, err = netpbmNumber(r, "width", 1, maxImageCells); err != nil {
+		return nil, err
+	}
+	if img.height, err = netpbmNumber(r, "height", 1, maxImageCells/img.width); err != nil {
+		return nil, err
+	}
+	maxval := 1
+	if magic == "P2" || magic == "P5" {
+		if maxval, err = netpbmNumber(r, "maxval", 1, 65535); err != nil {
+			return nil, err
+		}
+	}
+	img.grey = make([]uint8, img.width*img.height)
+
+	switch magic {
+	case "P1":
+		for i := range img.grey {
+			c, err := netpbmBit(r)
+			if err != nil {
+				return nil, fmt.Errorf("netpbm: truncated bitmap after %d of %d pixels: %v", i, len(img.grey), err)
+			}
+			img.grey[i] = 255 * c
+		}
+	case "P2":
+		for i := range img.grey {
+			sample, err := netpbmNumber(r, "sample", 0, maxval)
+			if err != nil {
+				return nil, err
+			}
+			img.grey[i] = scaleSample(sample, maxval)
+		}
+	case "P4":
+		row := make([]byte, (img.width+7)/8)
+		for y := 0; y < img.height; y++ {
+			if _, err := io.ReadFull(r, row); err != nil {
+				return nil, fmt.Errorf("netpbm: truncated bitmap at row %d: %v", y, err)
+			}
+			for x := 0; x < img.width; x++ {
+				img.grey[y*img.width+x] = 255 * (row[x/8] >> uint(7-x%8) & 1)
+			}
+		}
+	case "P5":
+		//Samples are one byte, or two bytes (most significant first) if maxval is over 255
+		size := 1
+		if maxval > 255 {
+			size = 2
+		}
+		raster := make([]byte, size*len(img.grey))
+		if _, err := io.ReadFull(r, raster); err != nil {
+			return nil, fmt.Errorf("netpbm: truncated raster: %v", err)
+		}
+		for i := range img.grey {
+			sample := int(raster[i])
+			if size == 2 {
+				sample = int(raster[2*i])<<8 | int(raster[2*i+1])
+			}
+			if sample > maxval {
+				return nil, fmt.Errorf("netpbm: sample %d is larger than the maxval %d", sample, maxval)
+			}
+			img.grey[i] = scaleSample(sample, maxval)
+		}
+	}
+	return img, nil
+}
+
+// scaleSample scales a sample from 0 to maxval to the nearest grey level from 0 to 255.
+func scaleSample(sample, maxval int) uint8 {
+	return uint8((sample*255 + maxval/2) / maxval)
+}
+
+// isNetpbmSpace reports whether c separates the fields of a Netpbm file.
+func isNetpbmSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\v' || c == '\f' || c == '\r'
+}
+
+// netpbmToken returns the next field of a Netpbm file, skipping whitespace and comments before it.
+// Exactly one whitespace byte after the field is consumed, as binary rasters start straight after it.
+func netpbmToken(r *bufio.Reader) (string, error) {
+	var token []byte
+	for {
+		c, err := r.ReadByte()
+		if err == io.EOF && len(token) > 0 {
+			return string(token), nil
+		} else if err != nil {
+			return "", err
+		}
+		switch {
+		case c == '#' && len(token) > 0:
+			return string(token), r.UnreadByte()
+		case c == '#':
+			if _, err := r.ReadString('\n'); err != nil {
+				return "", err
+			}
+		case isNetpbmSpace(c) && len(token) > 0:
+			return string(token), nil
+		case !isNetpbmSpace(c):
+			token = append(token, c)
+		}
+	}
+}
+
+// netpbmNumber reads a field of a Netpbm file that must be a number from min to max.
+func netpbmNumber(r *bufio.Reader, name string, min, max int) (int, error) {
+	token, err := netpbmToken(r)
+	if err != nil {
+		return 0, fmt.Errorf("netpbm: missing %s: %v", name, err)
+	}
+	n, err := strconv.Atoi(token)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("netpbm: invalid %s %q: expected a number from %d to %d", name, token, min, max)
+	}
+	return n, nil
+}
+
+// netpbmBit reads a pixel of a plain (P1) bitmap, where pixels don't need to be separated by whitespace.
+func netpbmBit(r *bufio.Reader) (uint8, error) {
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case c == '0' || c == '1':
+			return c - '0', nil
+		case c == '#':
+			if _, err := r.ReadString('\n'); err != nil {
+				return 0, err
+			}
+		case !isNetpbmSpace(c):
+			return 0, fmt.Errorf("unexpected %q", c)
+		}
+	}
+}
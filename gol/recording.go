@@ -0,0 +1,179 @@
+package gol
+
+import (
+	"io"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// Recording is a run played back from its events, such as those read by ReadEvents, without running it
+// again. It is made of frames that can be stepped through in either direction: the world as each
+// TurnComplete event was sent, after the initial world in frame 0.
+type Recording struct {
+	frames                 []recordedFrame
+	minX, minY, maxX, maxY int
+	cells                  bool // whether any cell changed, and so whether the bounds hold one
+}
+
+// recordedFrame is the changes to the world that lead up to a frame of a Recording, and the other events
+// sent meanwhile.
+type recordedFrame struct {
+	turn     int
+	flipped  []util.Cell
+	changed  []util.Cell
+	states   []uint8 // the state each changed cell changed to
+	previous []uint8 // the state each changed cell changed from
+	others   []Event
+}
+
+// NewRecording returns the recording of a run that sent events. Events after the last TurnComplete event
+// are left out, apart from any cells that changed.
+func NewRecording(events []Event) *Recording {
+	r := new(Recording)
+	states := make(map[util.Cell]uint8)
+	var f recordedFrame
+	changed := false
+	end := func(turn int) {
+		f.turn = turn
+		r.frames = append(r.frames, f)
+		f, changed = recordedFrame{}, false
+	}
+	//Cells that change on another turn than those before them, such as the first turn after the initial
+	//world, start a frame of their own
+	change := func(turn int) {
+		if changed && turn != f.turn {
+			end(f.turn)
+		}
+		f.turn, changed = turn, true
+	}
+	for _, event := range events {
+		switch e := event.(type) {
+		case CellFlipped:
+			change(e.CompletedTurns)
+			f.flipped = append(f.flipped, e.Cell)
+			r.include(e.Cell)
+		case CellsFlipped:
+			change(e.CompletedTurns)
+			f.flipped = append(f.flipped, e.Cells...)
+			for _, cell := range e.Cells {
+				r.include(cell)
+			}
+		case CellStateChanged:
+			change(e.CompletedTurns)
+			f.changed = append(f.changed, e.Cell)
+			f.states = append(f.states, e.State)
+			f.previous = append(f.previous, states[e.Cell])
+			if e.State == dead {
+				delete(states, e.Cell)
+			} else {
+				states[e.Cell] = e.State
+			}
+			r.include(e.Cell)
+		case TurnComplete:
+			end(e.CompletedTurns)
+		case FinalTurnComplete:
+		default:
+			f.others = append(f.others, event)
+		}
+	}
+	if changed {
+		end(f.turn)
+	}
+	return r
+}
+
+// ReadRecording reads the recording of a run from the events written by an EventEncoder.
+func ReadRecording(r io.Reader) (*Recording, error) {
+	var events []Event
+	d := NewEventDecoder(r)
+	for {
+		event, err := d.Decode()
+		if err == io.EOF {
+			return NewRecording(events), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+}
+
+// include grows the bounds of the recording to hold cell.
+func (r *Recording) include(cell util.Cell) {
+	if !r.cells {
+		r.minX, r.minY, r.maxX, r.maxY, r.cells = cell.X, cell.Y, cell.X, cell.Y, true
+		return
+	}
+	if cell.X < r.minX {
+		r.minX = cell.X
+	}
+	if cell.Y < r.minY {
+		r.minY = cell.Y
+	}
+	if cell.X > r.maxX {
+		r.maxX = cell.X
+	}
+	if cell.Y > r.maxY {
+		r.maxY = cell.Y
+	}
+}
+
+// Frames returns the number of frames of the recording.
+func (r *Recording) Frames() int {
+	return len(r.frames)
+}
+
+// Turn returns the number of turns completed in frame i.
+func (r *Recording) Turn(i int) int {
+	return r.frames[i].turn
+}
+
+// Bounds returns the top left cell and the size of the smallest rectangle that holds every cell that
+// changed in the recording.
+func (r *Recording) Bounds() (x, y, width, height int) {
+	if !r.cells {
+		return 0, 0, 0, 0
+	}
+	return r.minX, r.minY, r.maxX - r.minX + 1, r.maxY - r.minY + 1
+}
+
+// Seek returns the first frame in which turn was completed, the first frame after it if it never was, or
+// the last frame if the recording ends before it.
+func (r *Recording) Seek(turn int) int {
+	for i, f := range r.frames {
+		if f.turn >= turn {
+			return i
+		}
+	}
+	return len(r.frames) - 1
+}
+
+// Frame returns the events that take the world from frame i-1, or an empty world if i is 0, to frame i:
+// a CellsFlipped event, a CellStateChanged event for every cell that changed state, the other events sent
+// before the TurnComplete event of the frame, and that TurnComplete.
+func (r *Recording) Frame(i int) []Event {
+	f := r.frames[i]
+	var events []Event
+	if len(f.flipped) > 0 {
+		events = append(events, CellsFlipped{f.turn, f.flipped})
+	}
+	for j, cell := range f.changed {
+		events = append(events, CellStateChanged{f.turn, cell, f.states[j]})
+	}
+	events = append(events, f.others...)
+	return append(events, TurnComplete{f.turn})
+}
+
+// Back returns the events that take the world from frame i back to frame i-1, which must be a frame: the
+// cells of frame i flipped back, the states they changed from, and the TurnComplete event of frame i-1.
+func (r *Recording) Back(i int) []Event {
+	f, turn := r.frames[i], r.frames[i-1].turn
+	var events []Event
+	if len(f.flipped) > 0 {
+		events = append(events, CellsFlipped{turn, f.flipped})
+	}
+	for j := len(f.changed) - 1; j >= 0; j-- {
+		events = append(events, CellStateChanged{turn, f.changed[j], f.previous[j]})
+	}
+	return append(events, TurnComplete{turn})
+}
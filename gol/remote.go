@@ -0,0 +1,101 @@
+package gol
+
+import (
+	"fmt"
+	"net/rpc"
+)
+
+// remote is the engine for a world run by a broker, which the controller only sends commands to and
+// receives changed cells from. The first error it gets from the broker stops the run.
+//
+// Changed cells are only requested if flips is set, as they are sent from the workers through the broker
+// every turn: for an active pattern this is as much as sending the whole world, which BenchmarkHaloExchange
+// measures.
+type remote struct {
+	client  *rpc.Client
+	events  chan<- Event
+	states  int
+	flips   bool
+	workers int
+	failed  error
+	pending delta // the cells changed since the distributor last took them
+}
+
+// newRemote connects to the broker at address and starts a run of world on it, from the given turn. If flips
+// is set, the cells that change are fetched every turn.
+func newRemote(address string, world *board, turn int, r rule, t Topology, flips bool, events chan<- Event) (*remote, error) {
+	client, err := rpc.Dial("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("broker: %v", err)
+	}
+	var workers int
+	req := StartRequest{Rule: r.String(), Topology: t, Turn: turn, World: world.rows(0, world.height)}
+	if err := client.Call("Broker.Start", req, &workers); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("broker: %v", err)
+	}
+	fmt.Println("Running on", workers, "workers")
+	return &remote{client: client, events: events, states: r.states, flips: flips, workers: workers}, nil
+}
+
+// call calls a method of the broker, unless an earlier call has failed.
+func (e *remote) call(method string, args, reply interface{}) {
+	if e.failed == nil {
+		if err := e.client.Call(method, args, reply); err != nil {
+			e.failed = fmt.Errorf("broker: %v", err)
+		}
+	}
+}
+
+// err returns the first error the broker replied with.
+func (e *remote) err() error {
+	return e.failed
+}
+
+// step has the broker progress the world by one turn, and keeps the cells it changed if they are wanted.
+// A ClusterChange is sent if the broker lost workers during the turn.
+func (e *remote) step(turn int) {
+	var reply StepReply
+	e.call("Broker.Step", StepRequest{Turn: turn, Flipped: e.flips}, &reply)
+	if e.failed == nil && reply.Workers < e.workers {
+		e.workers = reply.Workers
+		e.events <- ClusterChange{turn, e.workers}
+	}
+	e.pending.flipped = append(e.pending.flipped, reply.Flipped...)
+	e.pending.changed = append(e.pending.changed, reply.Changed...)
+	e.pending.states = append(e.pending.states, reply.States...)
+}
+
+// changes returns the cells the broker changed since it was last called, if they were requested.
+func (e *remote) changes() delta {
+	d := e.pending
+	e.pending = delta{}
+	return d
+}
+
+func (e *remote) aliveCount() int {
+	var count int
+	e.call("Broker.AliveCount", 0, &count)
+	return count
+}
+
+// snapshot fetches the world from the broker. If the broker has failed, it is empty.
+func (e *remote) snapshot() (*board, int, int) {
+	var world BoardRows
+	e.call("Broker.Snapshot", 0, &world)
+	if e.failed != nil {
+		return newBoard(0, 0, e.states), 0, 0
+	}
+	return world.board(), 0, 0
+}
+
+// kill shuts down the broker and its workers.
+func (e *remote) kill() {
+	e.call("Broker.Shutdown", 0, new(bool))
+}
+
+// stop releases the broker for other controllers.
+func (e *remote) stop() {
+	e.client.Call("Broker.Stop", 0, new(bool))
+	e.client.Close()
+}
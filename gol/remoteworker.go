@@ -0,0 +1,260 @@
+package gol
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// haloTimeout is how long a worker waits for the halo rows of its neighbours before giving up on the turn.
+const haloTimeout = 10 * time.Second
+
+// remoteWorker is a worker on another machine, which owns a strip of the world given to it by the broker.
+// Like a local worker it exchanges its first and last rows with the workers above and below it every turn,
+// but directly over RPC, so that the broker only has to start each turn and wait for it to complete.
+type remoteWorker struct {
+	mu       sync.Mutex // held for the whole of a turn
+	listener net.Listener
+
+	rule        rule
+	topology    Topology
+	epoch       int32 // the split of the world the strip belongs to, set atomically
+	startY      int
+	worldHeight int
+	strip, next *board
+
+	up, down  *rpc.Client
+	fromAbove chan HaloRequest // last row of the worker above, sent to us by its Halo call
+	fromBelow chan HaloRequest // first row of the worker below
+	halos     [2][]uint64      // buffers for halo rows that cross the top and bottom edges of the world
+	abort     chan bool        // stops a turn waiting for a neighbour that may have failed
+}
+
+// ServeWorker registers with the broker at the given address as a worker listening on l, then accepts
+// connections from the broker and other workers until l is closed. The address of l must be reachable
+// from the broker and every other worker.
+func ServeWorker(l net.Listener, broker string) error {
+	server := rpc.NewServer()
+	w := &remoteWorker{
+		fromAbove: make(chan HaloRequest, 1),
+		fromBelow: make(chan HaloRequest, 1),
+		abort:     make(chan bool, 1),
+		listener:  l,
+	}
+	if err := server.RegisterName("Worker", w); err != nil {
+		return err
+	}
+
+	//The broker connects back to l while registering, which waits in its backlog until it is accepted
+	client, err := rpc.Dial("tcp", broker)
+	if err != nil {
+		return err
+	}
+	var workers int
+	err = client.Call("Broker.Register", l.Addr().String(), &workers)
+	client.Close()
+	if err != nil {
+		return err
+	}
+	fmt.Println("Registered as worker", workers)
+
+	server.Accept(l)
+	return nil
+}
+
+// Setup replaces the strip of the worker, and connects to its neighbours.
+func (w *remoteWorker) Setup(req SetupRequest, _ *bool) error {
+	r, err := parseRule(req.Rule)
+	if err != nil {
+		return err
+	}
+	if r.larger() || req.Topology == CrossSurface {
+		return fmt.Errorf("rule %v on a %v: workers only exchange single halo rows", r, req.Topology)
+	}
+	if !req.Strip.valid(r.states) {
+		return fmt.Errorf("malformed %dx%d strip", req.Strip.Width, req.Strip.Height)
+	}
+	up, err := rpc.Dial("tcp", req.Up)
+	if err != nil {
+		return err
+	}
+	down, err := rpc.Dial("tcp", req.Down)
+	if err != nil {
+		up.Close()
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.up != nil {
+		w.up.Close()
+		w.down.Close()
+	}
+	w.rule, w.topology, w.startY, w.worldHeight = r, req.Topology, req.StartY, req.WorldHeight
+	atomic.StoreInt32(&w.epoch, int32(req.Epoch))
+	w.strip = req.Strip.board()
+	if r.states <= 2 {
+		w.strip.dying, w.strip.decay = nil, nil
+	}
+	w.next = newBoard(w.strip.width, w.strip.height, r.states)
+	w.up, w.down = up, down
+	//Halos left over from a turn that failed part way through are skipped by their epoch, but aborts aren't
+	for len(w.abort) > 0 {
+		<-w.abort
+	}
+	w.halos = [2][]uint64{make([]uint64, w.strip.stride), make([]uint64, w.strip.stride)}
+	return nil
+}
+
+// Halo receives a row from a neighbouring worker for the turn it is about to progress.
+func (w *remoteWorker) Halo(req HaloRequest, _ *bool) error {
+	if req.FromAbove {
+		w.fromAbove <- req
+	} else {
+		w.fromBelow <- req
+	}
+	return nil
+}
+
+// Abort stops the turn the worker is waiting to progress, if it belongs to the given split of the world.
+func (w *remoteWorker) Abort(epoch int, _ *bool) error {
+	if int32(epoch) == atomic.LoadInt32(&w.epoch) {
+		select {
+		case w.abort <- true:
+		default:
+		}
+	}
+	return nil
+}
+
+// Shutdown stops the worker accepting connections, so that ServeWorker returns.
+func (w *remoteWorker) Shutdown(_ int, _ *bool) error {
+	fmt.Println("Shutting down")
+	return w.listener.Close()
+}
+
+// Ping lets the broker know that the worker is still there.
+func (w *remoteWorker) Ping(_ int, _ *bool) error {
+	return nil
+}
+
+// Step swaps halo rows with the neighbouring workers, then progresses the strip by one turn.
+// It replies with the changed cells if they are requested.
+func (w *remoteWorker) Step(req StepRequest, reply *StepReply) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.strip == nil {
+		return errors.New("the worker hasn't been set up")
+	}
+
+	//Neighbours buffer halos as soon as they arrive, so sending first can't deadlock
+	epoch, last := int(atomic.LoadInt32(&w.epoch)), w.strip.height-1
+	toUp := w.up.Go("Worker.Halo", HaloRequest{Epoch: epoch, Turn: req.Turn, Row: w.strip.row(0)}, new(bool), nil)
+	toDown := w.down.Go("Worker.Halo", HaloRequest{Epoch: epoch, Turn: req.Turn, FromAbove: true, Row: w.strip.row(last)}, new(bool), nil)
+	fromAbove, fromBelow, err := w.receiveHalos(epoch, toUp.Done, toDown.Done)
+	if err != nil {
+		return fmt.Errorf("halo exchange: %v", err)
+	}
+	if fromAbove.Epoch != epoch || fromBelow.Epoch != epoch || fromAbove.Turn != req.Turn || fromBelow.Turn != req.Turn {
+		return fmt.Errorf("received halos for turns %d and %d during turn %d", fromAbove.Turn, fromBelow.Turn, req.Turn)
+	}
+	if len(fromAbove.Row) != w.strip.stride || len(fromBelow.Row) != w.strip.stride {
+		return errors.New("received halo rows of the wrong width")
+	}
+
+	above := fromAbove.Row
+	if w.startY == 0 {
+		above = w.topology.crossEdge(above, w.halos[0], w.strip.width)
+	}
+	below := fromBelow.Row
+	if w.startY+w.strip.height == w.worldHeight {
+		below = w.topology.crossEdge(below, w.halos[1], w.strip.width)
+	}
+	progressStrip(w.strip, w.next, above, below, w.rule, w.topology)
+	if req.Flipped {
+		*reply = changedCells(w.strip, w.next, w.startY)
+	}
+	w.strip, w.next = w.next, w.strip
+	return nil
+}
+
+// receiveHalos waits for both halo rows of a turn and for both of the halo rows it sent to be received,
+// skipping any halos left over from an earlier split of the world. A neighbour that is unreachable fails
+// it straight away, and one that has stopped responding after haloTimeout, so that the broker gets an
+// error rather than waiting forever. The broker can also abort it once another worker has failed.
+func (w *remoteWorker) receiveHalos(epoch int, toUp, toDown chan *rpc.Call) (fromAbove, fromBelow HaloRequest, err error) {
+	timeout := time.NewTimer(haloTimeout)
+	defer timeout.Stop()
+	above, below := w.fromAbove, w.fromBelow
+	for above != nil || below != nil || toUp != nil || toDown != nil {
+		//Channels are set to nil once they have been received from, so that they block
+		var call *rpc.Call
+		select {
+		case fromAbove = <-above:
+			if fromAbove.Epoch >= epoch {
+				above = nil
+			}
+		case fromBelow = <-below:
+			if fromBelow.Epoch >= epoch {
+				below = nil
+			}
+		case call = <-toUp:
+			toUp = nil
+		case call = <-toDown:
+			toDown = nil
+		case <-timeout.C:
+			return fromAbove, fromBelow, errors.New("timed out waiting for a neighbouring worker")
+		case <-w.abort:
+			return fromAbove, fromBelow, errors.New("aborted")
+		}
+		if call != nil && call.Error != nil {
+			return fromAbove, fromBelow, call.Error
+		}
+	}
+	return fromAbove, fromBelow, nil
+}
+
+// AliveCount replies with the number of alive cells in the strip.
+func (w *remoteWorker) AliveCount(_ int, count *int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.strip == nil {
+		return errors.New("the worker hasn't been set up")
+	}
+	*count = w.strip.aliveCount()
+	return nil
+}
+
+// Snapshot replies with a copy of the strip.
+func (w *remoteWorker) Snapshot(_ int, strip *BoardRows) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.strip == nil {
+		return errors.New("the worker hasn't been set up")
+	}
+	*strip = w.strip.rows(0, w.strip.height)
+	return nil
+}
+
+// progressStrip calculates the next state of strip into next, given the halo rows above and below it.
+func progressStrip(strip, next *board, above, below []uint64, r rule, t Topology) {
+	last := strip.height - 1
+	for y := 0; y <= last; y++ {
+		rowAbove, rowBelow := above, below
+		if y > 0 {
+			rowAbove = strip.row(y - 1)
+		}
+		if y < last {
+			rowBelow = strip.row(y + 1)
+		}
+		nextRow(next.row(y), t.pad(rowAbove, strip.width), t.pad(strip.row(y), strip.width), t.pad(rowBelow, strip.width),
+			strip.dyingRow(y), strip.width, r)
+		if strip.dying != nil {
+			strip.nextDecayRow(next, y, r.states)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package gol
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// rleLineLength is the longest line written in the body of an RLE file.
+const rleLineLength = 70
+
+// rlePattern is a pattern read from an RLE file.
+type rlePattern struct {
+	width, height int
+	rule          string    // empty if the header doesn't give one
+	cells         [][]uint8 // the state of every cell, row by row
+}
+
+// readRleHeader reads up to and including the header line of an RLE file (x = 3, y = 3, rule = B3/S23),
+// skipping the comment lines before it, such as #N for the name of the pattern and #C for comments.
+func readRleHeader(r *bufio.Reader) (*rlePattern, error) {
+	var header string
+	for header == "" {
+		line, err := r.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line != "" && line[0] != '#' {
+			header = line
+		} else if err != nil {
+			return nil, fmt.Errorf("rle: missing header line")
+		}
+	}
+
+	p := &rlePattern{width: -1, height: -1}
+	fields := strings.Split(header, ",")
+	for i, field := range fields {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("rle: invalid header %q", header)
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		var err error
+		switch key {
+		case "x":
+			p.width, err = strconv.Atoi(value)
+		case "y":
+			p.height, err = strconv.Atoi(value)
+		case "rule":
+			//Larger than Life rules have commas of their own, so the rule is the rest of the line
+			p.rule = strings.TrimSpace(strings.Join(append([]string{parts[1]}, fields[i+1:]...), ","))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rle: invalid header %q", header)
+		}
+		if key == "rule" {
+			break
+		}
+	}
+	if p.width < 0 || p.height < 0 {
+		return nil, fmt.Errorf("rle: the header %q must give the size of the pattern as x and y", header)
+	}
+	return p, nil
+}
+
+// readRle reads an RLE file. Two-state patterns use b for dead and o for alive cells, and multi-state
+// patterns use . for dead cells, A to X for states 1 to 24, and pA to yX for states 25 to 255.
+// Each run of cells may be preceded by a count, $ ends a row and ! ends the pattern.
+func readRle(r *bufio.Reader) (*rlePattern, error) {
+	p, err := readRleHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	p.cells = make([][]uint8, p.height)
+	for y := range p.cells {
+		p.cells[y] = make([]uint8, p.width)
+	}
+
+	x, y, count := 0, 0, 0
+	var prefix byte
+	for {
+		c, err := r.ReadByte()
+		if err == io.EOF {
+			//The final ! is often missing
+			return p, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		run := count
+		if run == 0 {
+			run = 1
+		}
+		state := -1
+		switch {
+		case c >= '0' && c <= '9':
+			count = count*10 + int(c-'0')
+			if count > p.width+p.height {
+				return nil, fmt.Errorf("rle: run of %d cells is longer than the pattern", count)
+			}
+			continue
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			continue
+		case c == '!':
+			return p, nil
+		case c == '$':
+			x, y = 0, y+run
+		case c >= 'p' && c <= 'y' && prefix == 0:
+			prefix = c
+			continue
+		case c == 'b' || c == '.':
+			state = int(dead)
+		case c == 'o':
+			state = int(alive)
+		case c >= 'A' && c <= 'X':
+			state = int(c-'A') + 1
+			if prefix != 0 {
+				state += 24 * int(prefix-'p'+1)
+			}
+		default:
+			return nil, fmt.Errorf("rle: unexpected %q in the pattern", c)
+		}
+		if (prefix != 0 && (c < 'A' || c > 'X')) || state > maxStates-1 {
+			return nil, fmt.Errorf("rle: invalid state %c%c", prefix, c)
+		}
+
+		if state > 0 {
+			if y >= p.height || x+run > p.width {
+				return nil, fmt.Errorf("rle: the pattern is larger than its %dx%d header", p.width, p.height)
+			}
+			for i := 0; i < run; i++ {
+				p.cells[y][x+i] = uint8(state)
+			}
+		}
+		if state >= 0 {
+			x += run
+		}
+		count, prefix = 0, 0
+	}
+}
+
+// readRleRule returns the rule in the header of the RLE file at path, or an empty string if there is none.
+func readRleRule(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	p, err := readRleHeader(bufio.NewReader(file))
+	if err != nil {
+		return "", err
+	}
+	return p.rule, nil
+}
+
+// readRleImage opens an RLE file and returns the cell states of the world, with the pattern in its top left
+// corner. Under Generations rules, states the rule doesn't have are dying cells in their last state, and
+// under other rules they are dead.
+func (io *ioState) readRleImage(path string) ([]uint8, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	pattern, err := readRle(bufio.NewReader(file))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if pattern.width > io.params.ImageWidth || pattern.height > io.params.ImageHeight {
+		return nil, fmt.Errorf("%s: the %dx%d pattern doesn't fit in a %dx%d image",
+			path, pattern.width, pattern.height, io.params.ImageWidth, io.params.ImageHeight)
+	}
+
+	states := make([]uint8, 0, io.params.ImageWidth*io.params.ImageHeight)
+	for y := 0; y < io.params.ImageHeight; y++ {
+		for x := 0; x < io.params.ImageWidth; x++ {
+			state := dead
+			if y < pattern.height && x < pattern.width {
+				state = pattern.cells[y][x]
+			}
+			if io.states <= 2 && state > alive {
+				state = dead
+			} else if int(state) >= io.states {
+				state = uint8(io.states - 1)
+			}
+			states = append(states, state)
+		}
+	}
+	return states, nil
+}
+
+// rleWriter writes the runs of an RLE body, starting a new line before any run that would make the current
+// one longer than rleLineLength.
+type rleWriter struct {
+	w      *bufio.Writer
+	states int
+	line   int
+}
+
+// run writes count cells in the given state, or count row ends if state is -1, or the end of the pattern if state is -2.
+func (rw *rleWriter) run(count, state int) {
+	var tag string
+	switch {
+	case state == -2:
+		tag = "!"
+	case state == -1:
+		tag = "$"
+	case rw.states <= 2 && state == int(dead):
+		tag = "b"
+	case rw.states <= 2:
+		tag = "o"
+	case state == int(dead):
+		tag = "."
+	case state <= 24:
+		tag = string(rune('A' + state - 1))
+	default:
+		tag = string([]rune{rune('p' + (state-25)/24), rune('A' + (state-25)%24)})
+	}
+	if count > 1 {
+		tag = strconv.Itoa(count) + tag
+	}
+	if rw.line+len(tag) > rleLineLength {
+		_, _ = rw.w.WriteString("\n")
+		rw.line = 0
+	}
+	_, _ = rw.w.WriteString(tag)
+	rw.line += len(tag)
+}
+
+// writeRleImage receives cell states and writes them to an RLE file, with the name of the file in a #N line,
+// and the position of its top left cell in a #CXRLE line if it isn't at the origin.
+func (io *ioState) writeRleImage(path string) {
+	_ = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+
+	bounds := <-io.channels.bounds
+	world := make([][]uint8, bounds.height)
+	for y := range world {
+		world[y] = make([]uint8, bounds.width)
+		for x := range world[y] {
+			world[y][x] = <-io.channels.output
+		}
+	}
+
+	file, ioError := os.Create(path)
+	util.Check(ioError)
+	defer file.Close()
+	w := bufio.NewWriter(file)
+
+	_, _ = fmt.Fprintf(w, "#N %s\n", fileTitle(path))
+	if bounds.x != 0 || bounds.y != 0 {
+		_, _ = fmt.Fprintf(w, "#CXRLE Pos=%d,%d\n", bounds.x, bounds.y)
+	}
+	_, _ = fmt.Fprintf(w, "x = %d, y = %d, rule = %v\n", bounds.width, bounds.height, io.rule)
+
+	rw := &rleWriter{w: w, states: io.states}
+	rowEnds := 0 //rows that have ended but haven't been written, as they may be followed by empty rows
+	for _, row := range world {
+		//Dead cells at the end of a row are left out
+		end := len(row)
+		for end > 0 && row[end-1] == dead {
+			end--
+		}
+		if end > 0 && rowEnds > 0 {
+			rw.run(rowEnds, -1)
+			rowEnds = 0
+		}
+		for x := 0; x < end; {
+			length := 1
+			for x+length < end && row[x+length] == row[x] {
+				length++
+			}
+			rw.run(length, int(row[x]))
+			x += length
+		}
+		rowEnds++
+	}
+	rw.run(1, -2)
+	_, _ = w.WriteString("\n")
+
+	util.Check(w.Flush())
+	fmt.Println("File", fileTitle(path), "output done!")
+}
@@ -0,0 +1,130 @@
+package gol
+
+import (
+	"math/bits"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// The types below are sent over net/rpc between the controller, the broker and its workers, so their
+// fields are exported for gob to encode.
+
+// BoardRows is a block of rows of a board, in the same layout as the board itself.
+type BoardRows struct {
+	Width, Height int
+	Words         []uint64
+	Dying         []uint64 // nil for two-state rules
+	Decay         []uint8
+}
+
+// StartRequest is sent by the controller to the broker to start a run of World, which has completed Turn turns.
+type StartRequest struct {
+	Rule     string
+	Topology Topology
+	Turn     int
+	World    BoardRows
+}
+
+// StepRequest is sent by the controller to the broker, and by the broker to its workers, to progress
+// the world by one turn. The changed cells are only sent back if Flipped is set.
+type StepRequest struct {
+	Turn    int
+	Flipped bool
+}
+
+// StepReply tells the controller which cells changed in a turn run by the broker.
+type StepReply struct {
+	Flipped []util.Cell // cells that became alive or stopped being alive
+	Changed []util.Cell // under Generations rules, every cell whose state changed
+	States  []uint8     // the new state of each of the Changed cells
+	Workers int         // the number of workers the world is split between
+}
+
+// SetupRequest is sent by the broker to give a worker its strip of the world, which starts at row StartY,
+// and the addresses of the workers with the strips above and below it. Epoch counts the times the broker
+// has split a world between its workers.
+type SetupRequest struct {
+	Rule        string
+	Topology    Topology
+	Epoch       int
+	StartY      int
+	WorldHeight int
+	Strip       BoardRows
+	Up, Down    string
+}
+
+// HaloRequest is sent by a worker to a neighbouring worker at the start of a turn, with the row of its
+// strip that borders the neighbour's. FromAbove is set if the row is above the neighbour's strip.
+type HaloRequest struct {
+	Epoch     int
+	Turn      int
+	FromAbove bool
+	Row       []uint64
+}
+
+// rows copies n rows of b, starting at row y.
+func (b *board) rows(y, n int) BoardRows {
+	r := BoardRows{Width: b.width, Height: n, Words: append([]uint64(nil), b.words[y*b.stride:(y+n)*b.stride]...)}
+	if b.dying != nil {
+		r.Dying = append([]uint64(nil), b.dying[y*b.stride:(y+n)*b.stride]...)
+		r.Decay = append([]uint8(nil), b.decay[y*b.width:(y+n)*b.width]...)
+	}
+	return r
+}
+
+// board returns the rows as a board, which aliases them.
+func (r BoardRows) board() *board {
+	return &board{
+		width:  r.Width,
+		height: r.Height,
+		stride: (r.Width + wordSize - 1) / wordSize,
+		words:  r.Words,
+		dying:  r.Dying,
+		decay:  r.Decay,
+	}
+}
+
+// valid reports whether the rows are laid out as a board for a rule with the given number of states.
+func (r BoardRows) valid(states int) bool {
+	stride := (r.Width + wordSize - 1) / wordSize
+	if r.Width < 1 || r.Height < 1 || len(r.Words) != stride*r.Height {
+		return false
+	}
+	return states <= 2 || (len(r.Dying) == len(r.Words) && len(r.Decay) == r.Width*r.Height)
+}
+
+// apply changes the cells of b that changed in a turn.
+func (b *board) apply(changes StepReply) {
+	if b.dying != nil {
+		for i, cell := range changes.Changed {
+			b.setState(cell.X, cell.Y, changes.States[i])
+		}
+		return
+	}
+	for _, cell := range changes.Flipped {
+		b.set(cell.X, cell.Y, !b.get(cell.X, cell.Y))
+	}
+}
+
+// changedCells returns the cells that differ between two turns of a strip starting at row startY of the
+// world, in the same way that local workers send them as events.
+func changedCells(strip, next *board, startY int) StepReply {
+	var reply StepReply
+	for y := 0; y < strip.height; y++ {
+		row, newRow, dying := strip.row(y), next.row(y), strip.dyingRow(y)
+		for i := range row {
+			flipped := row[i] ^ newRow[i]
+			for word := flipped; word != 0; word &= word - 1 {
+				reply.Flipped = append(reply.Flipped, util.Cell{X: i*wordSize + bits.TrailingZeros64(word), Y: startY + y})
+			}
+			if dying != nil {
+				for word := flipped | dying[i]; word != 0; word &= word - 1 {
+					x := i*wordSize + bits.TrailingZeros64(word)
+					reply.Changed = append(reply.Changed, util.Cell{X: x, Y: startY + y})
+					reply.States = append(reply.States, next.state(x, y))
+				}
+			}
+		}
+	}
+	return reply
+}
@@ -0,0 +1,284 @@
+package gol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// conway is the rule used when Params.Rule is empty.
+const conway = "B3/S23"
+
+// maxStates is the largest number of states a Generations rule can have, so that states fit in a byte.
+const maxStates = 256
+
+// maxRadius is the largest neighbourhood radius of a Larger than Life rule.
+const maxRadius = 500
+
+// rule is a life-like or Generations rule. Bit n of birth is set if a dead cell with n live neighbours
+// becomes alive, and bit n of survival is set if a live cell with n live neighbours stays alive.
+// Cells that don't survive decay through states-2 refractory states before they are dead, which
+// makes states 2 for ordinary life-like rules.
+//
+// Larger than Life rules count the alive cells within radius of a cell instead (including the cell
+// itself if middle is set), in either a square (Moore) or diamond (von Neumann) neighbourhood,
+// and cells are born or survive when their count is within a range.
+type rule struct {
+	birth, survival uint16
+	states          int
+
+	radius                   int
+	vonNeumann               bool
+	middle                   bool
+	birthMin, birthMax       int
+	survivalMin, survivalMax int
+}
+
+// larger reports whether r needs the Larger than Life kernel, rather than the word-parallel one for
+// radius 1 Moore neighbourhoods.
+func (r rule) larger() bool {
+	return r.radius > 1 || r.vonNeumann
+}
+
+// parseRule parses a rule in B/S notation (e.g. B36/S23) or the legacy S/B notation (e.g. 23/36).
+// Generations rules add a number of states, as in B2/S/C3 or /2/3, and Larger than Life rules
+// use Golly's notation, as in R5,C0,M1,S34..58,B34..45,NM. An empty string is Conway's Game of Life.
+func parseRule(s string) (rule, error) {
+	if s == "" {
+		s = conway
+	}
+	upper := strings.ToUpper(s)
+	if len(upper) > 1 && upper[0] == 'R' && upper[1] >= '0' && upper[1] <= '9' {
+		return parseLarger(s, upper)
+	}
+	if strings.ContainsAny(upper, "BSC") {
+		return parseBS(s, upper)
+	}
+
+	//Legacy notation lists survival counts first, then birth counts, then the number of states
+	parts := strings.Split(upper, "/")
+	if len(parts) != 2 && len(parts) != 3 {
+		return rule{}, fmt.Errorf("invalid rule %q: expected B/S or S/B notation", s)
+	}
+	r := rule{states: 2, radius: 1}
+	var err error
+	if r.survival, err = parseCounts(s, parts[0]); err != nil {
+		return rule{}, err
+	}
+	if r.birth, err = parseCounts(s, parts[1]); err != nil {
+		return rule{}, err
+	}
+	if len(parts) == 3 {
+		if r.states, err = parseStates(s, parts[2]); err != nil {
+			return rule{}, err
+		}
+	}
+	return r, nil
+}
+
+// parseBS parses the B/S(/C) notation, where the slashes between parts are optional.
+func parseBS(s, upper string) (rule, error) {
+	r := rule{states: 2, radius: 1}
+	var seenB, seenS, seenC bool
+	for len(upper) > 0 {
+		prefix := upper[0]
+		upper = upper[1:]
+		end := strings.IndexAny(upper, "/BSC")
+		if end == -1 {
+			end = len(upper)
+		}
+		var err error
+		switch {
+		case prefix == 'B' && !seenB:
+			r.birth, err = parseCounts(s, upper[:end])
+			seenB = true
+		case prefix == 'S' && !seenS:
+			r.survival, err = parseCounts(s, upper[:end])
+			seenS = true
+		case prefix == 'C' && !seenC:
+			r.states, err = parseStates(s, upper[:end])
+			seenC = true
+		default:
+			err = fmt.Errorf("invalid rule %q: expected B/S or S/B notation", s)
+		}
+		if err != nil {
+			return rule{}, err
+		}
+		upper = strings.TrimPrefix(upper[end:], "/")
+	}
+	if !seenB || !seenS {
+		return rule{}, fmt.Errorf("invalid rule %q: both B and S must be given", s)
+	}
+	return r, nil
+}
+
+// parseLarger parses a Larger than Life rule: a comma separated list of the radius (R), number of
+// states (C, where 0 means 2), whether the middle cell is counted (M), the survival (S) and birth (B)
+// ranges, and the neighbourhood type (NM for Moore or NN for von Neumann). C, M and N may be left out.
+func parseLarger(s, upper string) (rule, error) {
+	r := rule{states: 2}
+	var seenS, seenB bool
+	for _, part := range strings.Split(upper, ",") {
+		if part == "" {
+			return rule{}, fmt.Errorf("invalid rule %q: empty part", s)
+		}
+		value := part[1:]
+		var err error
+		switch part[0] {
+		case 'R':
+			r.radius, err = strconv.Atoi(value)
+			if err != nil || r.radius < 1 || r.radius > maxRadius {
+				err = fmt.Errorf("invalid rule %q: the radius must be between 1 and %d", s, maxRadius)
+			}
+		case 'C':
+			if value != "0" {
+				r.states, err = parseStates(s, value)
+			}
+		case 'M':
+			if value != "0" && value != "1" {
+				err = fmt.Errorf("invalid rule %q: M must be 0 or 1", s)
+			}
+			r.middle = value == "1"
+		case 'S':
+			r.survivalMin, r.survivalMax, err = parseRange(s, value)
+			seenS = true
+		case 'B':
+			r.birthMin, r.birthMax, err = parseRange(s, value)
+			seenB = true
+		case 'N':
+			if value != "M" && value != "N" {
+				err = fmt.Errorf("invalid rule %q: the neighbourhood must be NM or NN", s)
+			}
+			r.vonNeumann = value == "N"
+		default:
+			err = fmt.Errorf("invalid rule %q: unknown part %q", s, part)
+		}
+		if err != nil {
+			return rule{}, err
+		}
+	}
+	if !seenB || !seenS {
+		return rule{}, fmt.Errorf("invalid rule %q: both B and S must be given", s)
+	}
+
+	//A radius 1 Moore neighbourhood can use the faster life-like kernel
+	if !r.larger() {
+		middle := 0
+		if r.middle {
+			middle = 1
+		}
+		for n := 0; n <= 8; n++ {
+			if r.birthMin <= n && n <= r.birthMax {
+				r.birth |= 1 << uint(n)
+			}
+			if r.survivalMin <= n+middle && n+middle <= r.survivalMax {
+				r.survival |= 1 << uint(n)
+			}
+		}
+	}
+	return r, nil
+}
+
+// parseRange parses an inclusive range of neighbour counts, written min..max, or a single count.
+func parseRange(s, value string) (int, int, error) {
+	bounds := strings.Split(value, "..")
+	if len(bounds) > 2 {
+		return 0, 0, fmt.Errorf("invalid rule %q: invalid range %q", s, value)
+	}
+	min, err := strconv.Atoi(bounds[0])
+	if err != nil || min < 0 {
+		return 0, 0, fmt.Errorf("invalid rule %q: invalid range %q", s, value)
+	}
+	max := min
+	if len(bounds) == 2 {
+		max, err = strconv.Atoi(bounds[1])
+		if err != nil || max < min {
+			return 0, 0, fmt.Errorf("invalid rule %q: invalid range %q", s, value)
+		}
+	}
+	return min, max, nil
+}
+
+// parseStates parses the number of states of a Generations rule.
+func parseStates(s, digits string) (int, error) {
+	states, err := strconv.Atoi(digits)
+	if err != nil || states < 2 || states > maxStates {
+		return 0, fmt.Errorf("invalid rule %q: the number of states must be between 2 and %d", s, maxStates)
+	}
+	return states, nil
+}
+
+// parseCounts parses a run of neighbour counts (digits 0-8) into a bit set.
+func parseCounts(s, digits string) (uint16, error) {
+	var counts uint16
+	for _, d := range digits {
+		if d < '0' || d > '8' {
+			return 0, fmt.Errorf("invalid rule %q: %q is not a neighbour count", s, d)
+		}
+		counts |= 1 << uint(d-'0')
+	}
+	return counts, nil
+}
+
+// String returns the rule in B/S notation, or Golly's notation for Larger than Life rules.
+func (r rule) String() string {
+	if r.larger() {
+		states, middle, neighbourhood := 0, 0, "M"
+		if r.states > 2 {
+			states = r.states
+		}
+		if r.middle {
+			middle = 1
+		}
+		if r.vonNeumann {
+			neighbourhood = "N"
+		}
+		return fmt.Sprintf("R%d,C%d,M%d,S%d..%d,B%d..%d,N%s", r.radius, states, middle,
+			r.survivalMin, r.survivalMax, r.birthMin, r.birthMax, neighbourhood)
+	}
+	s := "B" + countsString(r.birth) + "/S" + countsString(r.survival)
+	if r.states > 2 {
+		s += "/C" + strconv.Itoa(r.states)
+	}
+	return s
+}
+
+func countsString(counts uint16) string {
+	var digits []byte
+	for n := uint(0); n <= 8; n++ {
+		if counts&(1<<n) != 0 {
+			digits = append(digits, byte('0'+n))
+		}
+	}
+	return string(digits)
+}
+
+// nextWord returns which cells of a word are alive next turn, given the cells that are currently
+// alive, those that are dying (which can't be born) and the bit planes of their neighbour counts.
+func (r rule) nextWord(alive, dying, ones, twos, fours, eights uint64) uint64 {
+	var next uint64
+	for n := uint(0); n <= 8; n++ {
+		born, survives := r.birth&(1<<n) != 0, r.survival&(1<<n) != 0
+		if !born && !survives {
+			continue
+		}
+
+		//Select the cells whose neighbour count is exactly n
+		matches := ^uint64(0)
+		for bit, plane := range [4]uint64{ones, twos, fours, eights} {
+			if n&(1<<uint(bit)) != 0 {
+				matches &= plane
+			} else {
+				matches &^= plane
+			}
+		}
+
+		if born {
+			next |= matches &^ alive &^ dying
+		}
+		if survives {
+			next |= matches & alive
+		}
+	}
+	return next
+}
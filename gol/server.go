@@ -0,0 +1,273 @@
+package gol
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// drainTimeout is how long a server waits for its controller to receive the last events of a run.
+const drainTimeout = 5 * time.Second
+
+func init() {
+	//Events are sent to attached controllers as the Event interface, so gob needs to know every type of event
+	for _, event := range eventTypes {
+		gob.Register(event)
+	}
+}
+
+// PollReply is sent by a server to its controller with the events since the last poll. Done is set once
+// the run has finished, and these are the last of its events.
+type PollReply struct {
+	Events []Event
+	Done   bool
+}
+
+// CommandRequest is sent by a controller to a server, with the command of one of the methods of Controller.
+type CommandRequest struct {
+	Op   int
+	N    int
+	Path string
+}
+
+// CommandReply is sent by a server to its controller once it has carried out a command.
+type CommandReply struct {
+	Turn  int
+	Alive []util.Cell
+}
+
+// server runs a world for the controllers that attach to it (see Attach), and carries on running it while
+// none is. It follows the events of the run to keep a copy of the world at the last completed turn, which
+// a controller is sent as it attaches, followed by the events after it.
+type server struct {
+	mu       sync.Mutex
+	changed  *sync.Cond // broadcast when events are queued or taken, a controller detaches, or the run finishes
+	params   Params
+	control  *Controller
+	attached *serverSession // the connection of the attached controller, nil if there isn't one
+	queue    []Event        // events the attached controller hasn't polled for yet
+	done     bool           // set once the run has sent its last event
+
+	turn    int
+	state   State // Paused if the run is paused, Executing or Quitting otherwise
+	alive   map[util.Cell]bool
+	states  map[util.Cell]uint8 // cells that aren't dead under Generations rules
+	pending []Event             // cell events since turn was completed
+}
+
+// serverSession is a connection to a server, which serves its RPC methods. It tells the server which
+// controller is calling.
+type serverSession struct {
+	s *server
+}
+
+// Serve runs the world described by p, accepting a controller at a time on l, until the run finishes or
+// is killed by a controller (see Controller.Kill). The final world is written as usual. The run is never
+// Headless, as the copy of the world sent to controllers is kept from the cells that change.
+func Serve(l net.Listener, p Params) error {
+	defer l.Close()
+	var err error
+	if p.Resume != "" {
+		if p, err = ResumeParams(p); err != nil {
+			return err
+		}
+	}
+	p.Headless = false
+	events := make(chan Event, 1000)
+	control, err := Start(context.Background(), p, events)
+	if err != nil {
+		return err
+	}
+	s := &server{params: p, control: control, alive: make(map[util.Cell]bool), states: make(map[util.Cell]uint8)}
+	s.changed = sync.NewCond(&s.mu)
+	go s.accept(l)
+
+	for event := range events {
+		s.relay(event)
+	}
+
+	s.mu.Lock()
+	s.done = true
+	s.changed.Broadcast()
+	s.mu.Unlock()
+	for deadline := time.Now().Add(drainTimeout); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		s.mu.Lock()
+		draining := s.attached != nil && len(s.queue) > 0
+		s.mu.Unlock()
+		if !draining {
+			break
+		}
+	}
+	return control.Wait()
+}
+
+// accept serves each connection on l with its own session, and detaches its controller once it closes.
+func (s *server) accept(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		session := &serverSession{s}
+		server := rpc.NewServer()
+		if err := server.RegisterName("Server", session); err != nil {
+			conn.Close()
+			return
+		}
+		go func() {
+			server.ServeConn(conn)
+			session.Detach(0, new(bool))
+		}()
+	}
+}
+
+// relay queues an event for the attached controller, and keeps the copy of the world up to date with it.
+func (s *server) relay(event Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attached != nil {
+		s.queue = append(s.queue, event)
+		s.changed.Broadcast()
+	}
+	switch e := event.(type) {
+	case CellFlipped, CellsFlipped, CellStateChanged:
+		s.pending = append(s.pending, event)
+	case StateChange:
+		s.state = e.NewState
+	case TurnComplete:
+		for _, event := range s.pending {
+			switch e := event.(type) {
+			case CellFlipped:
+				s.flip(e.Cell)
+			case CellsFlipped:
+				for _, cell := range e.Cells {
+					s.flip(cell)
+				}
+			case CellStateChanged:
+				if e.State == dead {
+					delete(s.states, e.Cell)
+				} else {
+					s.states[e.Cell] = e.State
+				}
+			}
+		}
+		s.turn, s.pending = e.CompletedTurns, nil
+	}
+}
+
+// flip flips a cell of the copy of the world.
+func (s *server) flip(cell util.Cell) {
+	if s.alive[cell] {
+		delete(s.alive, cell)
+	} else {
+		s.alive[cell] = true
+	}
+}
+
+// Attach makes the caller the controller of the server, unless another controller is attached, and replies
+// with the params of the run. Its first poll returns the world at the last completed turn, followed by a
+// Paused StateChange if the run is paused.
+func (session *serverSession) Attach(_ int, p *Params) error {
+	s := session.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.done:
+		return errors.New("the run has finished")
+	case s.attached != nil && s.attached != session:
+		return errors.New("another controller is attached")
+	}
+	s.attached = session
+	s.queue = nil
+	if s.params.CellFlippedEvents {
+		for cell := range s.alive {
+			s.queue = append(s.queue, CellFlipped{s.turn, cell})
+		}
+	} else if len(s.alive) > 0 {
+		alive := make([]util.Cell, 0, len(s.alive))
+		for cell := range s.alive {
+			alive = append(alive, cell)
+		}
+		s.queue = append(s.queue, CellsFlipped{s.turn, alive})
+	}
+	for cell, state := range s.states {
+		s.queue = append(s.queue, CellStateChanged{s.turn, cell, state})
+	}
+	s.queue = append(s.queue, TurnComplete{s.turn})
+	s.queue = append(s.queue, s.pending...)
+	if s.state == Paused {
+		s.queue = append(s.queue, StateChange{s.turn, Paused})
+	}
+	*p = s.params
+	fmt.Println("Controller attached on turn", s.turn)
+	return nil
+}
+
+// Poll waits for events, and replies with every event since the last poll.
+func (session *serverSession) Poll(_ int, reply *PollReply) error {
+	s := session.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.attached == session && len(s.queue) == 0 && !s.done {
+		s.changed.Wait()
+	}
+	if s.attached != session {
+		return errors.New("the controller isn't attached")
+	}
+	reply.Events, reply.Done = s.queue, s.done
+	s.queue = nil
+	s.changed.Broadcast()
+	return nil
+}
+
+// Command carries out a command on the run, as the method of Controller it came from would. Controllers
+// detach instead of quitting, and save the world on the machine the server runs on.
+func (session *serverSession) Command(req CommandRequest, reply *CommandReply) error {
+	s := session.s
+	s.mu.Lock()
+	attached := s.attached == session
+	s.mu.Unlock()
+	if !attached {
+		return errors.New("the controller isn't attached")
+	}
+	var err error
+	switch op(req.Op) {
+	case opPause:
+		reply.Turn, err = s.control.Pause()
+	case opResume:
+		reply.Turn, err = s.control.Resume()
+	case opStep:
+		reply.Turn, err = s.control.Step(req.N)
+	case opBack:
+		reply.Turn, err = s.control.Back()
+	case opSnapshot:
+		reply.Alive, reply.Turn, err = s.control.Snapshot()
+	case opSave:
+		reply.Turn, err = s.control.Save(req.Path)
+	case opKill:
+		err = s.control.Kill()
+	default:
+		err = fmt.Errorf("unknown command %d", req.Op)
+	}
+	return err
+}
+
+// Detach stops sending events to the controller, and lets another controller attach.
+func (session *serverSession) Detach(_ int, _ *bool) error {
+	s := session.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attached == session {
+		s.attached, s.queue = nil, nil
+		s.changed.Broadcast()
+		fmt.Println("Controller detached on turn", s.turn)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package gol
+
+import (
+	"math/bits"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// tileSize is the width and height of the tiles of an unbounded universe, so that each row of a tile is a single word.
+const tileSize = wordSize
+
+// tileShift converts cell coordinates to tile coordinates (rounding towards minus infinity).
+const tileShift = 6
+
+// tile is a tileSize x tileSize square of an unbounded universe, with cell x of row y at bit x of word y.
+type tile [tileSize]uint64
+
+// emptyTile stands in for the tiles that aren't stored because they have no alive cells.
+var emptyTile tile
+
+// tileKey is the position of a tile: tile (x, y) holds cells (x*tileSize, y*tileSize) up to
+// (but not including) ((x+1)*tileSize, (y+1)*tileSize).
+type tileKey struct {
+	x, y int
+}
+
+// sparse is the engine for unbounded universes. It only stores the tiles with alive cells, so the
+// universe grows and shrinks with the pattern, and each turn it splits the tiles that may have alive
+// cells next turn between threads goroutines.
+type sparse struct {
+	tiles   map[tileKey]*tile
+	threads int
+	rule    rule
+	flipped []util.Cell // the cells flipped since the distributor last took them
+}
+
+// newSparse returns an unbounded universe holding world, with its top left cell at (x, y).
+func newSparse(world *board, x, y, threads int, r rule) *sparse {
+	s := &sparse{
+		tiles:   make(map[tileKey]*tile),
+		threads: threads,
+		rule:    r,
+	}
+	for _, cell := range world.aliveCells() {
+		cell.X += x
+		cell.Y += y
+		key := tileKey{cell.X >> tileShift, cell.Y >> tileShift}
+		t := s.tiles[key]
+		if t == nil {
+			t = new(tile)
+			s.tiles[key] = t
+		}
+		t[cell.Y&(tileSize-1)] |= 1 << uint(cell.X&(tileSize-1))
+	}
+	return s
+}
+
+// get returns the tile at key, or the empty tile if it isn't stored.
+func (s *sparse) get(key tileKey) *tile {
+	if t, ok := s.tiles[key]; ok {
+		return t
+	}
+	return &emptyTile
+}
+
+// active returns the tiles that may have alive cells next turn: every stored tile, and the neighbouring
+// tiles that its edge cells touch.
+func (s *sparse) active() []tileKey {
+	seen := make(map[tileKey]bool, 2*len(s.tiles))
+	var keys []tileKey
+	add := func(key tileKey) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	for key, t := range s.tiles {
+		var columns uint64
+		for _, word := range t {
+			columns |= word
+		}
+		north, south := t[0] != 0, t[tileSize-1] != 0
+		west, east := columns&1 != 0, columns>>(tileSize-1) != 0
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				if (dy == -1 && !north) || (dy == 1 && !south) || (dx == -1 && !west) || (dx == 1 && !east) {
+					continue
+				}
+				add(tileKey{key.x + dx, key.y + dy})
+			}
+		}
+	}
+	return keys
+}
+
+// tileResult is the next state of a tile, or nil if it has no alive cells, and the cells that flipped in it.
+type tileResult struct {
+	key     tileKey
+	next    *tile
+	flipped []util.Cell
+}
+
+// step progresses the universe by one turn. The current tiles are only read while the goroutines run,
+// and the results are collected into a new map once they have all finished.
+func (s *sparse) step(turn int) {
+	keys := s.active()
+	if len(keys) == 0 {
+		return
+	}
+	results := make(chan []tileResult)
+	lengths := sectionLengths(len(keys), s.threads)
+	for i := 0; i < len(lengths)-1; i++ {
+		go s.progress(keys[lengths[i]:lengths[i+1]], turn, results)
+	}
+
+	next := make(map[tileKey]*tile, len(s.tiles))
+	for i := 0; i < len(lengths)-1; i++ {
+		for _, result := range <-results {
+			s.flipped = append(s.flipped, result.flipped...)
+			if result.next != nil {
+				next[result.key] = result.next
+			}
+		}
+	}
+	s.tiles = next
+}
+
+// progress calculates the next state of the tiles at keys, and the cells that flip in them.
+func (s *sparse) progress(keys []tileKey, turn int, results chan<- []tileResult) {
+	out := make([]tileResult, 0, len(keys))
+	for _, key := range keys {
+		//Look up the tile and its neighbours once, rather than for every row
+		var around [3][3]*tile
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				around[dy+1][dx+1] = s.get(tileKey{key.x + dx, key.y + dy})
+			}
+		}
+		padded := func(y int) paddedRow {
+			j := 1
+			if y < 0 {
+				j, y = 0, y+tileSize
+			} else if y >= tileSize {
+				j, y = 2, y-tileSize
+			}
+			return paddedRow{around[j][1][y : y+1], around[j][0][y] >> (tileSize - 1), around[j][2][y] & 1}
+		}
+
+		current := around[1][1]
+		next := new(tile)
+		var flipped []util.Cell
+		empty := true
+		for y := 0; y < tileSize; y++ {
+			nextRow(next[y:y+1], padded(y-1), padded(y), padded(y+1), nil, tileSize, s.rule)
+			empty = empty && next[y] == 0
+
+			//Every bit that differs between the old and new row is a flipped cell
+			for word := current[y] ^ next[y]; word != 0; word &= word - 1 {
+				x := key.x*tileSize + bits.TrailingZeros64(word)
+				flipped = append(flipped, util.Cell{X: x, Y: key.y*tileSize + y})
+			}
+		}
+		if empty {
+			next = nil
+		}
+		out = append(out, tileResult{key, next, flipped})
+	}
+	results <- out
+}
+
+// changes returns the cells flipped since it was last called. Unbounded universes only have two states.
+func (s *sparse) changes() delta {
+	d := delta{flipped: s.flipped}
+	s.flipped = nil
+	return d
+}
+
+// aliveCount returns the number of alive cells in the universe.
+func (s *sparse) aliveCount() int {
+	count := 0
+	for _, t := range s.tiles {
+		for _, word := range t {
+			count += bits.OnesCount64(word)
+		}
+	}
+	return count
+}
+
+// snapshot copies the bounding box of the alive cells into a board, which is empty if there are none.
+func (s *sparse) snapshot() (*board, int, int) {
+	if len(s.tiles) == 0 {
+		return newBoard(0, 0, 2), 0, 0
+	}
+	first := true
+	var minX, minY, maxX, maxY int
+	for key, t := range s.tiles {
+		var columns uint64
+		top, bottom := -1, 0
+		for y, word := range t {
+			if word != 0 {
+				if top == -1 {
+					top = y
+				}
+				bottom = y
+				columns |= word
+			}
+		}
+		left := key.x*tileSize + bits.TrailingZeros64(columns)
+		right := key.x*tileSize + tileSize - 1 - bits.LeadingZeros64(columns)
+		top, bottom = key.y*tileSize+top, key.y*tileSize+bottom
+		if first || left < minX {
+			minX = left
+		}
+		if first || right > maxX {
+			maxX = right
+		}
+		if first || top < minY {
+			minY = top
+		}
+		if first || bottom > maxY {
+			maxY = bottom
+		}
+		first = false
+	}
+
+	world := newBoard(maxX-minX+1, maxY-minY+1, 2)
+	for key, t := range s.tiles {
+		for y, word := range t {
+			for ; word != 0; word &= word - 1 {
+				x := key.x*tileSize + bits.TrailingZeros64(word)
+				world.set(x-minX, key.y*tileSize+y-minY, true)
+			}
+		}
+	}
+	return world, minX, minY
+}
+
+// stop does nothing, as the goroutines of an unbounded universe only run during a turn.
+func (s *sparse) stop() {}
@@ -0,0 +1,179 @@
+package gol
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// Topology represents how the edges of the world are joined together.
+// Under every topology other than Torus some edges border an infinite region of dead cells.
+type Topology int
+
+const (
+	// Torus joins the left edge to the right edge and the top edge to the bottom edge.
+	Torus Topology = iota
+	// Plane surrounds the world with dead cells.
+	Plane
+	// Cylinder joins the left edge to the right edge, the top and bottom edges border dead cells.
+	Cylinder
+	// KleinBottle joins the left edge to the right edge, and the top edge to the bottom edge with a twist,
+	// so that cell (x, -1) is cell (width-1-x, height-1).
+	KleinBottle
+	// CrossSurface joins both pairs of edges with a twist. Beyond a corner both twists apply,
+	// so that each corner cell is its own diagonal neighbour.
+	CrossSurface
+)
+
+// topologyNames are the names used by String and ParseTopology.
+var topologyNames = map[Topology]string{
+	Torus:        "torus",
+	Plane:        "plane",
+	Cylinder:     "cylinder",
+	KleinBottle:  "klein",
+	CrossSurface: "cross",
+}
+
+func (t Topology) String() string {
+	if name, ok := topologyNames[t]; ok {
+		return name
+	}
+	return "Incorrect Topology"
+}
+
+// ParseTopology returns the Topology with the given name: torus, plane, cylinder, klein or cross.
+func ParseTopology(name string) (Topology, error) {
+	for t, n := range topologyNames {
+		if n == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown topology %q: expected torus, plane, cylinder, klein or cross", name)
+}
+
+// wrapsVertically reports whether cells above the top edge are joined to cells on the bottom edge.
+func (t Topology) wrapsVertically() bool {
+	return t == Torus || t == KleinBottle || t == CrossSurface
+}
+
+// wrapsHorizontally reports whether cells beyond the left edge are joined to cells on the right edge.
+func (t Topology) wrapsHorizontally() bool {
+	return t != Plane
+}
+
+// wrap maps the cell at (x, y), at most one width or height beyond the edges of the world, to the cell
+// of the world it is joined to. ok is false if the cell is in the dead region around the world.
+func (t Topology) wrap(x, y, width, height int) (wrappedX, wrappedY int, ok bool) {
+	if y < 0 || y >= height {
+		if !t.wrapsVertically() {
+			return 0, 0, false
+		}
+		y = (y + height) % height
+		if t == KleinBottle || t == CrossSurface {
+			x = width - 1 - x
+		}
+	}
+	if x < 0 || x >= width {
+		if !t.wrapsHorizontally() {
+			return 0, 0, false
+		}
+		x = (x + width) % width
+		if t == CrossSurface {
+			y = height - 1 - y
+		}
+	}
+	return x, y, true
+}
+
+// edgeColumns holds the first and last column of the world, so that workers can find the cells just beyond
+// the west and east edges of a row, which are always in one of those columns but may belong to another
+// worker's strip. They are double buffered: during a turn, workers read the columns of the current turn
+// and write their own rows of the columns for the next one.
+type edgeColumns struct {
+	topology      Topology
+	width, height int
+	first, last   [2][]uint64
+}
+
+func newEdgeColumns(t Topology, width, height int) *edgeColumns {
+	e := &edgeColumns{topology: t, width: width, height: height}
+	for i := range e.first {
+		e.first[i] = make([]uint64, height)
+		e.last[i] = make([]uint64, height)
+	}
+	return e
+}
+
+// publish records the first and last cells of row, which is row y of the world at the given turn.
+func (e *edgeColumns) publish(turn, y int, row []uint64) {
+	lastX := e.width - 1
+	e.first[turn%2][y] = row[0] & 1
+	e.last[turn%2][y] = row[lastX/wordSize] >> uint(lastX%wordSize) & 1
+}
+
+// edges returns the cells just beyond the west and east edges of row y of the world at the given turn.
+// y may be above or below the world, for halo rows.
+func (e *edgeColumns) edges(turn, y int) (west, east uint64) {
+	return e.cell(turn, -1, y), e.cell(turn, e.width, y)
+}
+
+func (e *edgeColumns) cell(turn, x, y int) uint64 {
+	x, y, ok := e.topology.wrap(x, y, e.width, e.height)
+	switch {
+	case !ok:
+		return 0
+	case x == 0:
+		return e.first[turn%2][y]
+	default:
+		return e.last[turn%2][y]
+	}
+}
+
+// crossEdge returns halo rows of the given width from across the top or bottom edge of the world as seen
+// from the other side of it: unchanged on a torus, dead if the edge isn't joined, and otherwise reversed
+// into buffer.
+func (t Topology) crossEdge(halo, buffer []uint64, width int) []uint64 {
+	switch {
+	case t == Torus:
+		return halo
+	case !t.wrapsVertically():
+		for i := range buffer {
+			buffer[i] = 0
+		}
+	default:
+		stride := (width + wordSize - 1) / wordSize
+		for i := 0; i < len(halo); i += stride {
+			reverseRow(buffer[i:i+stride], halo[i:i+stride], width)
+		}
+	}
+	return buffer
+}
+
+// pad returns row with the cells just beyond its west and east edges. It is only valid for topologies
+// other than CrossSurface, where both cells are in the row itself.
+func (t Topology) pad(row []uint64, width int) paddedRow {
+	if !t.wrapsHorizontally() {
+		return paddedRow{words: row}
+	}
+	lastX := width - 1
+	return paddedRow{row, row[lastX/wordSize] >> uint(lastX%wordSize) & 1, row[0] & 1}
+}
+
+// reverseRow writes row, which is width cells wide, into dst in reverse order.
+func reverseRow(dst, row []uint64, width int) {
+	last := len(row) - 1
+	for i := range row {
+		dst[last-i] = bits.Reverse64(row[i])
+	}
+
+	//The reversed row is aligned to the end of its final word, shift it back to the start
+	shift := uint(len(row)*wordSize - width)
+	if shift == 0 {
+		return
+	}
+	for i := range dst {
+		dst[i] >>= shift
+		if i < last {
+			dst[i] |= dst[i+1] << (wordSize - shift)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package gol
+
+import (
+	"math/bits"
+
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// worker owns a horizontal strip of the world for the whole run and progresses it one turn at a time.
+// The only rows it shares are its first and last (or first and last radius rows under Larger than
+// Life rules), which it sends to the workers above and below it at the start of every turn in
+// exchange for their neighbouring (halo) rows.
+type worker struct {
+	startY int
+	strip  *board // the current state of the rows this worker owns
+	next   *board // the buffer the next turn is written into, swapped with strip after every turn
+
+	up, down  *worker
+	fromAbove chan []uint64 // last rows of the worker above
+	fromBelow chan []uint64 // first rows of the worker below
+	halos     [2][]uint64   // buffers for halo rows that cross the top and bottom edges of the world
+
+	rule        rule
+	topology    Topology
+	worldHeight int
+	edges       *edgeColumns
+	counter     *neighbourhoodCounter // only used by Larger than Life rules
+	turns       chan int
+
+	changes delta // the cells changed since the distributor last took them
+}
+
+// sectionLengths shows how to divide up a board of the given height between threads.
+// Worker i owns rows sectionLengths[i] up to (but not including) sectionLengths[i+1].
+func sectionLengths(height, threads int) []int {
+	if threads > height {
+		threads = height //every worker needs at least one row
+	}
+	lengths := make([]int, threads+1)
+	sectionLength := height / threads
+	remainingLength := height % threads
+	lengths[0] = 0
+	for i := 1; i < threads+1; i++ {
+		lengths[i] = lengths[i-1] + sectionLength //each section is sectionLength
+		if i <= remainingLength {
+			lengths[i]++ //the remaining length is distributed between threads
+		}
+	}
+	return lengths
+}
+
+// startWorkers splits world into strips, which is the world at the given turn, and starts a worker goroutine
+// for each of them. Workers wait for a turn number on their turns channel, and signal on done once they have
+// completed it.
+func startWorkers(world *board, turn, threads int, r rule, t Topology, done chan<- bool) []*worker {
+	//Halos can only come from neighbouring workers, so every strip needs at least radius rows
+	if maxThreads := world.height / r.radius; threads > maxThreads {
+		threads = maxThreads
+	}
+	lengths := sectionLengths(world.height, threads)
+	edges := newEdgeColumns(t, world.width, world.height)
+	for y := 0; y < world.height; y++ {
+		edges.publish(turn, y, world.row(y))
+	}
+	workers := make([]*worker, len(lengths)-1)
+	for i := range workers {
+		startY, endY := lengths[i], lengths[i+1]
+		strip := newBoard(world.width, endY-startY, r.states)
+		strip.copyRows(0, world, startY, endY-startY)
+		workers[i] = &worker{
+			startY:      startY,
+			strip:       strip,
+			next:        newBoard(world.width, endY-startY, r.states),
+			rule:        r,
+			fromAbove:   make(chan []uint64, 1),
+			fromBelow:   make(chan []uint64, 1),
+			halos:       [2][]uint64{make([]uint64, r.radius*world.stride), make([]uint64, r.radius*world.stride)},
+			topology:    t,
+			worldHeight: world.height,
+			edges:       edges,
+			turns:       make(chan int),
+		}
+		if r.larger() {
+			workers[i].counter = newNeighbourhoodCounter(r, t, world.width, endY-startY)
+		}
+	}
+
+	//The first and last workers are neighbours, even if the topology doesn't join the top and bottom edges
+	//(they still exchange halos, which are then ignored, so that every worker runs the same way)
+	for i, w := range workers {
+		w.up = workers[(i-1+len(workers))%len(workers)]
+		w.down = workers[(i+1)%len(workers)]
+	}
+
+	for _, w := range workers {
+		go w.run(done)
+	}
+	return workers
+}
+
+// run progresses the strip every time a turn is received, until the turns channel is closed.
+func (w *worker) run(done chan<- bool) {
+	for turn := range w.turns {
+		//Halo channels are buffered, so sending first can't deadlock (even when a worker is its own neighbour)
+		halo := w.rule.radius * w.strip.stride
+		w.up.fromBelow <- w.strip.words[:halo]
+		w.down.fromAbove <- w.strip.words[len(w.strip.words)-halo:]
+		above := w.crossEdge(<-w.fromAbove, w.startY == 0, w.halos[0])
+		below := w.crossEdge(<-w.fromBelow, w.startY+w.strip.height == w.worldHeight, w.halos[1])
+
+		w.progress(above, below, turn)
+		w.strip, w.next = w.next, w.strip
+		done <- true
+	}
+}
+
+// crossEdge returns halo rows received from a neighbouring worker as seen by this worker: if they come
+// from across the top or bottom edge of the world, they are reversed into buffer or dead depending on
+// the topology.
+func (w *worker) crossEdge(halo []uint64, acrossEdge bool, buffer []uint64) []uint64 {
+	if !acrossEdge {
+		return halo
+	}
+	return w.topology.crossEdge(halo, buffer, w.strip.width)
+}
+
+// padded returns a row of the strip, or of its halo, with the cells beyond its edges at the given turn.
+func (w *worker) padded(row []uint64, y, turn int) paddedRow {
+	west, east := w.edges.edges(turn, w.startY+y)
+	return paddedRow{row, west, east}
+}
+
+// progress calculates the next state of the strip into w.next, and keeps the cells it changes.
+// above and below are the halo rows; the distributor does not start another turn until every worker
+// is done, so the neighbouring strips they alias can't change underneath us.
+func (w *worker) progress(above, below []uint64, turn int) {
+	if w.counter != nil {
+		w.counter.count(w.strip, above, below)
+	}
+	last := w.strip.height - 1
+	for y := 0; y <= last; y++ {
+		row := w.strip.row(y)
+		newRow := w.next.row(y)
+		dying := w.strip.dyingRow(y)
+		if w.counter != nil {
+			w.counter.nextRow(newRow, row, dying, y)
+		} else {
+			rowAbove, rowBelow := above, below
+			if y > 0 {
+				rowAbove = w.strip.row(y - 1)
+			}
+			if y < last {
+				rowBelow = w.strip.row(y + 1)
+			}
+			nextRow(newRow, w.padded(rowAbove, y-1, turn), w.padded(row, y, turn), w.padded(rowBelow, y+1, turn),
+				dying, w.strip.width, w.rule)
+		}
+		w.edges.publish(turn+1, w.startY+y, newRow)
+		if dying != nil {
+			w.strip.nextDecayRow(w.next, y, w.rule.states)
+		}
+
+		//Every bit that differs between the old and new row is a flipped cell
+		for i := range row {
+			flipped := row[i] ^ newRow[i]
+			for word := flipped; word != 0; word &= word - 1 {
+				x := i*wordSize + bits.TrailingZeros64(word)
+				w.changes.flipped = append(w.changes.flipped, util.Cell{X: x, Y: w.startY + y})
+			}
+
+			//Under Generations rules every dying cell changes state too
+			if dying != nil {
+				for word := flipped | dying[i]; word != 0; word &= word - 1 {
+					x := i*wordSize + bits.TrailingZeros64(word)
+					w.changes.changed = append(w.changes.changed, util.Cell{X: x, Y: w.startY + y})
+					w.changes.states = append(w.changes.states, w.next.state(x, y))
+				}
+			}
+		}
+	}
+}
+
+// strips is the engine for bounded worlds, which keeps a worker for each horizontal strip of the world.
+type strips struct {
+	workers       []*worker
+	done          chan bool
+	width, height int
+	states        int
+}
+
+// newStrips starts the workers for world, which is the world at the given turn.
+func newStrips(world *board, turn, threads int, r rule, t Topology) *strips {
+	done := make(chan bool)
+	return &strips{
+		workers: startWorkers(world, turn, threads, r, t, done),
+		done:    done,
+		width:   world.width,
+		height:  world.height,
+		states:  r.states,
+	}
+}
+
+// step has every worker progress its strip by one turn, and waits until they have all finished.
+func (s *strips) step(turn int) {
+	for _, w := range s.workers {
+		w.turns <- turn
+	}
+	for range s.workers {
+		<-s.done
+	}
+}
+
+// stop ends every worker goroutine.
+func (s *strips) stop() {
+	for _, w := range s.workers {
+		close(w.turns)
+	}
+}
+
+// snapshot copies the strips into a single board.
+func (s *strips) snapshot() (*board, int, int) {
+	world := newBoard(s.width, s.height, s.states)
+	for _, w := range s.workers {
+		world.copyRows(w.startY, w.strip, 0, w.strip.height)
+	}
+	return world, 0, 0
+}
+
+// changes gathers the cells that the workers have changed since it was last called.
+func (s *strips) changes() delta {
+	var d delta
+	for _, w := range s.workers {
+		d.flipped = append(d.flipped, w.changes.flipped...)
+		d.changed = append(d.changed, w.changes.changed...)
+		d.states = append(d.states, w.changes.states...)
+		w.changes = delta{flipped: w.changes.flipped[:0], changed: w.changes.changed[:0], states: w.changes.states[:0]}
+	}
+	return d
+}
+
+// aliveCount returns the number of alive cells across the strips.
+func (s *strips) aliveCount() int {
+	count := 0
+	for _, w := range s.workers {
+		count += w.strip.aliveCount()
+	}
+	return count
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestHashLife tests 16x16, 64x64 and 512x512 images on 0, 1 and 100 turns with the HashLife engine, and
+// the 16x16 and 64x64 images on 1, 100 and 1000 turns in an unbounded universe.
+func TestHashLife(t *testing.T) {
+	for _, p := range []gol.Params{
+		{ImageWidth: 16, ImageHeight: 16},
+		{ImageWidth: 64, ImageHeight: 64},
+		{ImageWidth: 512, ImageHeight: 512},
+	} {
+		for _, turns := range []int{0, 1, 100} {
+			p.Turns, p.Threads, p.Engine = turns, 1, gol.HashLife
+			expectedAlive := readAliveCells(
+				"check/images/"+fmt.Sprintf("%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, turns),
+				p.ImageWidth,
+				p.ImageHeight,
+			)
+			t.Run(fmt.Sprintf("%dx%dx%d", p.ImageWidth, p.ImageHeight, p.Turns), func(t *testing.T) {
+				assertEqualBoard(t, runFinal(p), expectedAlive, p)
+			})
+		}
+	}
+
+	for _, test := range []struct {
+		size, turns         int
+		x, y, width, height int
+	}{
+		{16, 1, 3, 6, 3, 3},
+		{16, 1000, 253, 255, 3, 3},
+		{64, 1, 0, -1, 65, 66},
+		{64, 100, -6, -5, 81, 101},
+		{64, 1000, -181, -70, 440, 314},
+	} {
+		p := gol.Params{Turns: test.turns, Threads: 1, ImageWidth: test.size, ImageHeight: test.size, Unbounded: true, Engine: gol.HashLife}
+		var expectedAlive []util.Cell
+		for _, cell := range readAliveCells(fmt.Sprintf("check/unbounded/%vx%vx%v.pgm", test.size, test.size, test.turns), test.width, test.height) {
+			expectedAlive = append(expectedAlive, util.Cell{X: cell.X + test.x, Y: cell.Y + test.y})
+		}
+		t.Run(fmt.Sprintf("unbounded/%dx%dx%d", p.ImageWidth, p.ImageHeight, p.Turns), func(t *testing.T) {
+			assertEqualBoard(t, runFinal(p), expectedAlive, p)
+		})
+	}
+}
+
+// TestHashLifeLongRun runs far more turns than the parallel engine could: the glider of the 16x16 image is back
+// where it started every 64 turns, and the 512x512 image settles into a period 2 oscillation within 10000 turns.
+func TestHashLifeLongRun(t *testing.T) {
+	p := gol.Params{Turns: 1000000000, Threads: 1, ImageWidth: 16, ImageHeight: 16, Engine: gol.HashLife}
+	assertEqualBoard(t, runFinal(p), readAliveCells("images/16x16.pgm", 16, 16), p)
+
+	p = gol.Params{Turns: 1000000001, Threads: 1, ImageWidth: 512, ImageHeight: 512, Engine: gol.HashLife}
+	if alive := len(runFinal(p)); alive != 5567 {
+		t.Errorf("expected 5567 alive cells after %d turns, got %d", p.Turns, alive)
+	}
+}
+
+// TestHashLifeMemory checks that collecting the node cache under a low memory ceiling doesn't change the result.
+func TestHashLifeMemory(t *testing.T) {
+	p := gol.Params{Turns: 100, Threads: 1, ImageWidth: 512, ImageHeight: 512, Engine: gol.HashLife, HashLifeMemory: 1}
+	assertEqualBoard(t, runFinal(p), readAliveCells("check/images/512x512x100.pgm", 512, 512), p)
+}
+
+// TestHashLifeEvents checks that the CellsFlipped events sent at the end of each leap add up to the final alive
+// cells, and that turns are only completed in increasing order.
+func TestHashLifeEvents(t *testing.T) {
+	p := gol.Params{Turns: 1000, Threads: 1, ImageWidth: 64, ImageHeight: 64, Unbounded: true, Engine: gol.HashLife}
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	alive := make(map[util.Cell]bool)
+	var final []util.Cell
+	lastTurn := 0
+	for event := range events {
+		switch e := event.(type) {
+		case gol.CellsFlipped:
+			for _, cell := range e.Cells {
+				alive[cell] = !alive[cell]
+			}
+		case gol.TurnComplete:
+			if e.CompletedTurns <= lastTurn {
+				t.Fatalf("turn %d completed after turn %d", e.CompletedTurns, lastTurn)
+			}
+			lastTurn = e.CompletedTurns
+		case gol.FinalTurnComplete:
+			final = e.Alive
+		}
+	}
+	var flipped []util.Cell
+	for cell, isAlive := range alive {
+		if isAlive {
+			flipped = append(flipped, cell)
+		}
+	}
+	assertEqualBoard(t, flipped, final, p)
+}
+
+// TestInvalidHashLife checks that gol.Run rejects worlds and rules that HashLife doesn't support.
+func TestInvalidHashLife(t *testing.T) {
+	for _, p := range []gol.Params{
+		{ImageWidth: 16, ImageHeight: 16, Rule: "B2/S/C3"},
+		{ImageWidth: 16, ImageHeight: 16, Rule: "B0/S8"},
+		{ImageWidth: 16, ImageHeight: 16, Topology: gol.Plane},
+		{ImageWidth: 64, ImageHeight: 16},
+		{ImageWidth: 48, ImageHeight: 48},
+		{ImageWidth: 16, ImageHeight: 16, HashLifeMemory: -1},
+	} {
+		p.Turns, p.Threads, p.Engine = 1, 1, gol.HashLife
+		events := make(chan gol.Event)
+		if err := gol.Run(p, events, nil); err == nil {
+			t.Errorf("expected an error for %+v", p)
+		}
+		if _, ok := <-events; ok {
+			t.Error("expected events to be closed")
+		}
+	}
+}
+
+// runFinal runs the game of life and returns the alive cells of its FinalTurnComplete event.
+func runFinal(p gol.Params) []util.Cell {
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	var cells []util.Cell
+	for event := range events {
+		switch e := event.(type) {
+		case gol.FinalTurnComplete:
+			cells = e.Alive
+		}
+	}
+	return cells
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// keyPress is a key the keyboard harness presses, once the run has carried out the key before it and the
+// delay has passed.
+type keyPress struct {
+	key   rune
+	delay time.Duration
+}
+
+// TestKeyboard presses keys on 64x64 runs and checks the exact sequence of StateChange events they cause,
+// that each is sent on the turn the run was on, and that the only turns completed while a run is paused
+// are those it is stepped by, less those it is stepped back by, with a fast forward of 5 turns. No run executes for the 2s between alive
+// cell counts, even when paused for longer, so none should be counted at all.
+func TestKeyboard(t *testing.T) {
+	tests := []struct {
+		name     string
+		turns    int
+		presses  []keyPress
+		expected []gol.State
+		stepped  int
+	}{
+		{"no keys", 100, nil, []gol.State{gol.Executing, gol.Quitting}, 0},
+		{"quit", 1000000000, []keyPress{{'q', 10 * time.Millisecond}},
+			[]gol.State{gol.Executing, gol.Quitting}, 0},
+		{"pause and quit", 1000000000, []keyPress{{'p', 10 * time.Millisecond}, {'q', 10 * time.Millisecond}},
+			[]gol.State{gol.Executing, gol.Paused, gol.Quitting}, 0},
+		{"pause and resume", 1000000000,
+			[]keyPress{{'p', 10 * time.Millisecond}, {'p', 10 * time.Millisecond}, {'p', 10 * time.Millisecond}, {'p', 0}, {'q', 10 * time.Millisecond}},
+			[]gol.State{gol.Executing, gol.Paused, gol.Executing, gol.Paused, gol.Executing, gol.Quitting}, 0},
+		{"paused for longer than the ticker", 1000000000,
+			[]keyPress{{'p', 10 * time.Millisecond}, {'p', 2500 * time.Millisecond}, {'q', 10 * time.Millisecond}},
+			[]gol.State{gol.Executing, gol.Paused, gol.Executing, gol.Quitting}, 0},
+		{"save while running", 1000000000, []keyPress{{'s', 10 * time.Millisecond}, {'q', 10 * time.Millisecond}},
+			[]gol.State{gol.Executing, gol.Quitting}, 0},
+		{"kill", 1000000000, []keyPress{{'k', 10 * time.Millisecond}},
+			[]gol.State{gol.Executing, gol.Quitting}, 0},
+		{"step while paused", 1000000000,
+			[]keyPress{{'p', 10 * time.Millisecond}, {'n', 0}, {'n', 0}, {'f', 0}, {'p', 0}, {'q', 10 * time.Millisecond}},
+			[]gol.State{gol.Executing, gol.Paused, gol.Executing, gol.Quitting}, 7},
+		{"step back while paused", 1000000000,
+			[]keyPress{{'p', 10 * time.Millisecond}, {'n', 0}, {'n', 0}, {'b', 0}, {'p', 0}, {'q', 10 * time.Millisecond}},
+			[]gol.State{gol.Executing, gol.Paused, gol.Executing, gol.Quitting}, 1},
+		{"step while running", 1000000000, []keyPress{{'n', 10 * time.Millisecond}, {'f', 0}, {'b', 0}, {'q', 0}},
+			[]gol.State{gol.Executing, gol.Quitting}, 0},
+		{"save and quit while paused", 1000000000, []keyPress{{'p', 10 * time.Millisecond}, {'s', 0}, {'q', 0}},
+			[]gol.State{gol.Executing, gol.Paused, gol.Quitting}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := gol.Params{Turns: test.turns, Threads: 4, ImageWidth: 64, ImageHeight: 64, FastForward: 5}
+			events := pressKeys(t, p, test.presses)
+			assertStates(t, events, test.expected, test.stepped)
+			for _, event := range events {
+				if _, ok := event.(gol.AliveCellsCount); ok {
+					t.Errorf("alive cells counted on turn %d", event.GetCompletedTurns())
+				}
+			}
+		})
+	}
+}
+
+// pressKeys runs p and presses each key in turn, and returns every event of the run apart from those for
+// cells. Keys that change the state of the run are only followed by the next key once the StateChange they
+// cause has arrived, and other keys straight away.
+func pressKeys(t *testing.T, p gol.Params, presses []keyPress) []gol.Event {
+	events := make(chan gol.Event)
+	keyPresses := make(chan rune, 10)
+	go func() {
+		if err := gol.Run(p, events, keyPresses); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	//next is nil while the run is carrying out a key, and to begin with until it starts executing
+	var received []gol.Event
+	var next <-chan time.Time
+	ready := func() {
+		if len(presses) > 0 {
+			next = time.After(presses[0].delay)
+		}
+	}
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return received
+			}
+			switch event.(type) {
+			case gol.CellsFlipped, gol.CellStateChanged:
+				continue
+			case gol.StateChange:
+				if next == nil {
+					ready()
+				}
+			}
+			received = append(received, event)
+		case <-next:
+			key := presses[0].key
+			presses = presses[1:]
+			keyPresses <- key
+			next = nil
+			if key != 'p' && key != 'q' && key != 'k' {
+				ready()
+			}
+		}
+	}
+}
+
+// assertStates checks that the StateChange events are the expected states, each on the turn the run was
+// on, and that nothing happened while the run was paused apart from being stepped forward and back by the
+// given number of turns in all.
+func assertStates(t *testing.T, events []gol.Event, expected []gol.State, stepped int) {
+	var states []gol.State
+	turn, paused, steps := 0, false, 0
+	for _, event := range events {
+		switch e := event.(type) {
+		case gol.StateChange:
+			states = append(states, e.NewState)
+			if e.CompletedTurns != turn {
+				t.Errorf("%v on turn %d, after turn %d was completed", e.NewState, e.CompletedTurns, turn)
+			}
+			paused = e.NewState == gol.Paused
+		case gol.TurnComplete:
+			if paused {
+				steps += e.CompletedTurns - turn
+			}
+			turn = e.CompletedTurns
+		case gol.AliveCellsCount:
+			if paused {
+				t.Errorf("alive cells counted on turn %d while paused", e.CompletedTurns)
+			}
+		case gol.FinalTurnComplete:
+			if e.CompletedTurns != turn {
+				t.Errorf("final turn %d completed after turn %d", e.CompletedTurns, turn)
+			}
+		}
+	}
+	if steps != stepped {
+		t.Errorf("%d turns completed while paused, expected %d", steps, stepped)
+	}
+	if fmt.Sprint(states) != fmt.Sprint(expected) {
+		t.Errorf("expected the states %v, got %v", expected, states)
+	}
+	if _, ok := events[len(events)-1].(gol.StateChange); !ok {
+		t.Errorf("expected the last event to be a StateChange, got %v", events[len(events)-1])
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestLargerThanLife tests a 64x64 image on 1, 10 and 30 turns under Larger than Life rules with Moore and
+// von Neumann neighbourhoods, using 1-8 worker threads.
+func TestLargerThanLife(t *testing.T) {
+	rules := []string{
+		"R5,C0,M1,S34..58,B34..45,NM", // Bosco's Rule
+		"R2,C0,M0,S3..5,B3..4,NN",
+		"R3,C4,M1,S12..22,B12..16,NM",
+	}
+	p := gol.Params{ImageWidth: 64, ImageHeight: 64}
+	for _, rule := range rules {
+		p.Rule = rule
+		for _, turns := range []int{1, 10, 30} {
+			p.Turns = turns
+			expectedImage := readPgmPixels(t,
+				"check/rules/"+strings.NewReplacer(",", "", ".", "").Replace(rule)+fmt.Sprintf("/%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, turns))
+			var expectedAlive []util.Cell
+			for i, grey := range expectedImage {
+				if grey == 255 {
+					expectedAlive = append(expectedAlive, util.Cell{X: i % p.ImageWidth, Y: i / p.ImageWidth})
+				}
+			}
+			for threads := 1; threads <= 8; threads++ {
+				p.Threads = threads
+				testName := fmt.Sprintf("%s/%dx%dx%d-%d", rule, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+				t.Run(testName, func(t *testing.T) {
+					events := make(chan gol.Event)
+					go gol.Run(p, events, nil)
+					var cells []util.Cell
+					for event := range events {
+						switch e := event.(type) {
+						case gol.FinalTurnComplete:
+							cells = e.Alive
+						}
+					}
+					assertEqualBoard(t, cells, expectedAlive, p)
+
+					image := readPgmPixels(t, fmt.Sprintf("out/%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, turns))
+					if !bytes.Equal(image, expectedImage) {
+						t.Error("output image grey levels don't match the expected dying cells")
+					}
+				})
+			}
+		}
+	}
+}
+
+// TestLargerThanLifeRadius1 checks that a radius 1 Moore Larger than Life rule behaves like the equivalent life-like rule.
+func TestLargerThanLifeRadius1(t *testing.T) {
+	p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 64, ImageHeight: 64, Rule: "R1,C0,M0,S2..3,B3..3,NM"}
+	expectedAlive := readAliveCells("check/images/64x64x100.pgm", p.ImageWidth, p.ImageHeight)
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	var cells []util.Cell
+	for event := range events {
+		switch e := event.(type) {
+		case gol.FinalTurnComplete:
+			cells = e.Alive
+		}
+	}
+	assertEqualBoard(t, cells, expectedAlive, p)
+}
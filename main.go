@@ -1,12 +1,21 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"flag"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
 	"runtime"
+	"time"
 
 	"uk.ac.bris.cs/gameoflife/gol"
 	"uk.ac.bris.cs/gameoflife/sdl"
+	"uk.ac.bris.cs/gameoflife/web"
 )
 
 // main is the function called when starting Game of Life with 'go run .'
@@ -38,31 +47,328 @@ func main() {
 		10000000000,
 		"Specify the number of turns to process. Defaults to 10000000000.")
 
+	flag.StringVar(
+		&params.Rule,
+		"rule",
+		"",
+		"Specify the rule in B/S notation (e.g. B36/S23, or B2/S/C3 for Generations) or S/B notation (e.g. 23/36). Defaults to the rule of an RLE input, or B3/S23.")
+
+	flag.StringVar(
+		&params.Input,
+		"input",
+		"",
+		"Specify a .pgm or .pbm image or .rle pattern file to load. Defaults to images/<width>x<height>.pgm.")
+
+	flag.StringVar(
+		&params.OutputFormat,
+		"output",
+		"pgm",
+		"Specify the format to save the world in: pgm or rle. Defaults to pgm.")
+
+	topology := flag.String(
+		"topology",
+		"torus",
+		"Specify how the edges of the world are joined: torus, plane, cylinder, klein or cross. Defaults to torus.")
+
+	flag.BoolVar(
+		&params.Unbounded,
+		"unbounded",
+		false,
+		"Place the image on an infinite plane that grows with the pattern, instead of wrapping it around a torus.")
+
+	engine := flag.String(
+		"engine",
+		"parallel",
+		"Specify the engine: parallel, or hashlife for long runs of regular patterns. Defaults to parallel.")
+
+	flag.IntVar(
+		&params.HashLifeMemory,
+		"memory",
+		1024,
+		"Specify the memory ceiling of the HashLife node cache in megabytes. Defaults to 1024.")
+
+	flag.StringVar(
+		&params.Broker,
+		"broker",
+		"",
+		"Specify the address of a broker to run the world on its workers, e.g. 127.0.0.1:8030. Defaults to running locally.")
+
+	flag.IntVar(
+		&params.FastForward,
+		"fastForward",
+		100,
+		"Specify the number of turns that f steps a paused world by, while n steps it by one. Defaults to 100.")
+
+	flag.BoolVar(
+		&params.StopOnCycle,
+		"stopOnCycle",
+		false,
+		"Stop as soon as the world is static or periodic, with the world it would have after the number of turns.")
+
+	flag.IntVar(
+		&params.History,
+		"history",
+		100,
+		"Specify the number of turns that b can step a paused world back by. Defaults to 100.")
+
+	flag.StringVar(
+		&params.CheckpointDir,
+		"checkpoint",
+		"",
+		"Specify a directory to save checkpoints of the world in, which a later run can resume from. Defaults to not saving them.")
+
+	flag.DurationVar(
+		&params.CheckpointInterval,
+		"checkpointEvery",
+		time.Minute,
+		"Specify how often to save a checkpoint. Defaults to 1m.")
+
+	flag.StringVar(
+		&params.Resume,
+		"resume",
+		"",
+		"Specify a checkpoint to carry on running the world from, instead of loading an image. Its size, rule and topology are used.")
+
+	serve := flag.String(
+		"serve",
+		"",
+		"Specify an address to serve the world on, e.g. 127.0.0.1:8040, so that it keeps running while no controller is attached. Runs without the SDL window.")
+
+	attach := flag.String(
+		"attach",
+		"",
+		"Specify the address of a server to attach to as its controller, instead of running a world. 'q' detaches, and 'k' shuts the server down.")
+
+	eventsPath := flag.String(
+		"events",
+		"",
+		"Specify a file to write every event of the run to as JSON Lines, or - for standard output. Defaults to not writing them.")
+
+	httpAddress := flag.String(
+		"http",
+		"",
+		"Specify an address to show the world in a browser on as well, e.g. :8080, where p, s, q and k work as in the window. Defaults to not serving it.")
+
 	noVis := flag.Bool(
 		"noVis",
 		false,
 		"Disables the SDL window, so there is no visualisation during the tests.")
 
 	flag.Parse()
+	//Cells are still sent without a window if they are written to -events or shown in a browser
+	params.Headless = *noVis && *eventsPath == "" && *httpAddress == ""
+
+	events := make(chan gol.Event, 1000)
+	bus := gol.NewBus(events)
+
+	//Interrupting quits the run as q does, so that the final world is still written, and interrupting
+	//again ends the program straight away
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		<-interrupts
+		signal.Stop(interrupts)
+		cancel()
+	}()
+
+	if *attach != "" {
+		window, recorded, b := subscribe(bus, *noVis), record(bus, *eventsPath), newBrowser(bus, *httpAddress)
+		c, p, err := gol.Attach(ctx, *attach, events)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println("Attached to", *attach)
+		b.serve(p, c)
+		visualise(p, *noVis, bus, window, c)
+		if err := c.Wait(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := <-recorded; err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		b.wait()
+		return
+	}
+
+	var err error
+	params.Topology, err = gol.ParseTopology(*topology)
+	if err == nil {
+		params.Engine, err = gol.ParseEngine(*engine)
+	}
+	if err == nil && params.Resume != "" {
+		params, err = gol.ResumeParams(params)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
 	fmt.Println("Threads:", params.Threads)
 	fmt.Println("Width:", params.ImageWidth)
 	fmt.Println("Height:", params.ImageHeight)
+	if params.Rule != "" {
+		fmt.Println("Rule:", params.Rule)
+	}
+	if params.Input != "" {
+		fmt.Println("Input:", params.Input)
+	}
+	if params.Resume != "" {
+		fmt.Println("Resume:", params.Resume)
+	}
+	fmt.Println("Engine:", params.Engine)
+	if params.Broker != "" {
+		fmt.Println("Broker:", params.Broker)
+	}
+	if params.Unbounded {
+		fmt.Println("Topology: unbounded")
+	} else {
+		fmt.Println("Topology:", params.Topology)
+	}
 
-	keyPresses := make(chan rune, 10)
-	events := make(chan gol.Event, 1000)
+	if *serve != "" {
+		l, err := net.Listen("tcp", *serve)
+		if err == nil {
+			fmt.Println("Serving on", *serve)
+			err = gol.Serve(l, params)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	go gol.Run(params, events, keyPresses)
-	if !(*noVis) {
-		sdl.Run(params, events, keyPresses)
+	window, recorded, b := subscribe(bus, *noVis), record(bus, *eventsPath), newBrowser(bus, *httpAddress)
+	c, err := gol.Start(ctx, params, events)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	b.serve(params, c)
+	visualise(params, *noVis, bus, window, c)
+	//Wait for the final world to be written, or for the error the run failed with, and then for its events
+	if err := c.Wait(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := <-recorded; err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	b.wait()
+}
+
+// subscribe subscribes the SDL window to the events of a run, or with noVis just its FinalTurnComplete
+// event, and returns the channel they are sent down. It must be called before the run starts, so that the
+// initial world isn't missed.
+func subscribe(bus *gol.Bus, noVis bool) chan gol.Event {
+	events := make(chan gol.Event)
+	if !noVis {
+		//A window that can't keep up skips frames rather than holding up the run
+		bus.Subscribe(events, gol.Subscription{Policy: gol.Coalesce})
 	} else {
-		complete := false
-		for !complete {
-			event := <-events
-			switch event.(type) {
-			case gol.FinalTurnComplete:
-				complete = true
+		bus.Subscribe(events, gol.Subscription{Types: []gol.Event{gol.FinalTurnComplete{}}})
+	}
+	return events
+}
+
+// visualise shows the events of a run subscribed to with subscribe in the SDL window, or just waits for them
+// to finish with noVis. It returns once the final turn is complete or the events of the run are closed.
+func visualise(p gol.Params, noVis bool, bus *gol.Bus, events chan gol.Event, c *gol.Controller) {
+	defer bus.Unsubscribe(events)
+	if !noVis {
+		sdl.Run(p, events, c)
+	} else {
+		//events is closed early when a controller detaches from a server
+		<-events
+	}
+}
+
+// record writes every event of the run to path as JSON Lines, or to standard output if path is -, and
+// returns a channel that is sent the error it finished with once the events are closed. Nothing is written
+// if path is empty.
+func record(bus *gol.Bus, path string) <-chan error {
+	recorded := make(chan error, 1)
+	if path == "" {
+		recorded <- nil
+		return recorded
+	}
+	//Standard output is shared with other output, so each event is written to it straight away
+	var w io.Writer = os.Stdout
+	var file *os.File
+	var buffered *bufio.Writer
+	if path != "-" {
+		var err error
+		if file, err = os.Create(path); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		buffered = bufio.NewWriter(file)
+		w = buffered
+	}
+
+	//Every event is kept, so the run waits for each to be written
+	events := make(chan gol.Event)
+	bus.Subscribe(events, gol.Subscription{Policy: gol.Block})
+	go func() {
+		encoder := gol.NewEventEncoder(w)
+		var err error
+		for event := range events {
+			if err == nil {
+				err = encoder.Encode(event)
 			}
 		}
+		if file != nil {
+			if flushErr := buffered.Flush(); err == nil {
+				err = flushErr
+			}
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		recorded <- err
+	}()
+	return recorded
+}
+
+// browser shows a run in browsers on an address, as well as in the window.
+type browser struct {
+	l      net.Listener
+	viewer *web.Viewer
+}
+
+// newBrowser starts following the run on bus to show it in browsers on address once it is served, or
+// returns nil if address is empty.
+func newBrowser(bus *gol.Bus, address string) *browser {
+	if address == "" {
+		return nil
+	}
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return &browser{l, web.NewViewer(bus)}
+}
+
+// serve serves the page that shows the run of p in the background, with its keys pressed on c.
+func (b *browser) serve(p gol.Params, c *gol.Controller) {
+	if b == nil {
+		return
+	}
+	fmt.Println("Showing the world on", "http://"+b.l.Addr().String())
+	go http.Serve(b.l, b.viewer.Handler(p, c))
+}
+
+// wait waits for every browser to be sent the last of the run, and stops serving it.
+func (b *browser) wait() {
+	if b == nil {
+		return
 	}
+	b.viewer.Wait()
+	b.l.Close()
 }
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// TestNetpbm tests the 64x64 image on 100 turns when it is loaded from plain and raw bitmaps, plain and
+// 16 bit greymaps with grey levels either side of the threshold for alive cells, and a greymap whose dead
+// cells are whitespace bytes.
+func TestNetpbm(t *testing.T) {
+	expectedAlive := readAliveCells("check/images/64x64x100.pgm", 64, 64)
+	for _, input := range []string{
+		"check/netpbm/64x64-plain.pbm",
+		"check/netpbm/64x64-raw.pbm",
+		"check/netpbm/64x64-plain.pgm",
+		"check/netpbm/64x64-16bit.pgm",
+		"check/netpbm/64x64-whitespace.pgm",
+	} {
+		p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 64, ImageHeight: 64, Input: input}
+		t.Run(input, func(t *testing.T) {
+			assertEqualBoard(t, runFinal(p), expectedAlive, p)
+		})
+	}
+}
+
+// TestInvalidNetpbm checks that gol.Run returns an error, rather than panicking, for malformed or missing images.
+func TestInvalidNetpbm(t *testing.T) {
+	for _, input := range []string{
+		"check/netpbm/invalid/truncated.pgm",
+		"check/netpbm/invalid/magic.pgm",
+		"check/netpbm/invalid/maxval.pgm",
+		"check/netpbm/invalid/sample.pgm",
+		"check/netpbm/invalid/size.pgm",
+		"check/netpbm/invalid/header.pgm",
+		"check/netpbm/invalid/bitmap.pbm",
+		"check/netpbm/invalid/missing.pgm",
+	} {
+		t.Run(input, func(t *testing.T) {
+			p := gol.Params{Turns: 1, Threads: 1, ImageWidth: 64, ImageHeight: 64, Input: input}
+			events := make(chan gol.Event)
+			errors := make(chan error)
+			go func() {
+				errors <- gol.Run(p, events, nil)
+			}()
+			for range events {
+			}
+			if err := <-errors; err == nil {
+				t.Errorf("expected an error for %s", input)
+			}
+		})
+	}
+}
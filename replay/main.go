@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/sdl"
+)
+
+// main plays back the events of a run written with -events in a window, without running it again,
+// e.g. 'go run ./replay -fps 60 run.jsonl'
+func main() {
+	runtime.LockOSThread()
+	var p sdl.Playback
+
+	flag.Float64Var(
+		&p.FramesPerSecond,
+		"fps",
+		30,
+		"Specify how many turns to show every second. = and - double and halve it while playing. Defaults to 30.")
+
+	flag.IntVar(
+		&p.Turn,
+		"turn",
+		0,
+		"Specify the turn to start playing from. Defaults to the start of the run.")
+
+	flag.IntVar(
+		&p.Width,
+		"w",
+		0,
+		"Specify the width of the window. Defaults to the width of the cells that change, from the left edge of the image.")
+
+	flag.IntVar(
+		&p.Height,
+		"h",
+		0,
+		"Specify the height of the window. Defaults to the height of the cells that change, from the top edge of the image.")
+
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: replay [flags] <events file, or - for standard input>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || p.FramesPerSecond <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var in io.Reader = os.Stdin
+	if path := flag.Arg(0); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	}
+	r, err := gol.ReadRecording(in)
+	if err == nil && r.Frames() == 0 {
+		err = fmt.Errorf("%v: no turns were recorded", flag.Arg(0))
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	//The image of a bounded world starts at (0, 0), and an unbounded world is shown wherever its cells are
+	x, y, width, height := r.Bounds()
+	if x > 0 {
+		x, width = 0, width+x
+	}
+	if y > 0 {
+		y, height = 0, height+y
+	}
+	p.X, p.Y = x, y
+	if p.Width == 0 {
+		p.Width = width
+	}
+	if p.Height == 0 {
+		p.Height = height
+	}
+	if p.Width == 0 || p.Height == 0 {
+		p.Width, p.Height = 16, 16
+	}
+	fmt.Println("Turns:", r.Turn(0), "to", r.Turn(r.Frames()-1))
+	fmt.Println("Width:", p.Width)
+	fmt.Println("Height:", p.Height)
+	sdl.Replay(r, p)
+}
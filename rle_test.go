@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// TestRleInput tests loading RLE patterns: the 64x64 image on 0, 1 and 100 turns, the 16x16 image with a
+// HighLife rule in its header, and a Generations pattern with dying cells.
+func TestRleInput(t *testing.T) {
+	for _, turns := range []int{0, 1, 100} {
+		p := gol.Params{Turns: turns, Threads: 4, ImageWidth: 64, ImageHeight: 64, Input: "check/rle/64x64.rle"}
+		t.Run(fmt.Sprintf("64x64x%d", turns), func(t *testing.T) {
+			expectedAlive := readAliveCells(fmt.Sprintf("check/images/64x64x%d.pgm", turns), 64, 64)
+			assertEqualBoard(t, runFinal(p), expectedAlive, p)
+		})
+	}
+
+	t.Run("header rule", func(t *testing.T) {
+		p := gol.Params{Turns: 10, Threads: 4, ImageWidth: 16, ImageHeight: 16, Input: "check/rle/16x16-highlife.rle"}
+		assertEqualBoard(t, runFinal(p), readAliveCells("check/rules/B36S23/16x16x10.pgm", 16, 16), p)
+	})
+
+	//The pattern is the 64x64 image after 10 turns, so another 90 turns match the image after 100 turns
+	for _, turns := range []int{0, 90} {
+		p := gol.Params{Turns: turns, Threads: 4, ImageWidth: 64, ImageHeight: 64, Input: "check/rle/64x64x10-B2S345C4.rle"}
+		t.Run(fmt.Sprintf("generations/64x64x%d", turns), func(t *testing.T) {
+			runFinal(p)
+			image := readPgmPixels(t, fmt.Sprintf("out/64x64x%d.pgm", turns))
+			if !bytes.Equal(image, readPgmPixels(t, fmt.Sprintf("check/rules/B2S345C4/64x64x%d.pgm", turns+10))) {
+				t.Error("output image grey levels don't match the expected dying cells")
+			}
+		})
+	}
+}
+
+// TestRleOutput checks that RLE output has a header with the rule, wraps its lines at 70 characters, and
+// can be loaded again, for the 512x512 image after 100 turns and a Generations pattern.
+func TestRleOutput(t *testing.T) {
+	for _, test := range []struct {
+		rule, header string
+	}{
+		{"", "x = 512, y = 512, rule = B3/S23"},
+		{"B2/S345/C4", "x = 512, y = 512, rule = B2/S345/C4"},
+	} {
+		t.Run(test.header, func(t *testing.T) {
+			p := gol.Params{Turns: 100, Threads: 8, ImageWidth: 512, ImageHeight: 512, Rule: test.rule, OutputFormat: "rle"}
+			expected := runFinal(p)
+
+			data, err := ioutil.ReadFile("out/512x512x100.rle")
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			if lines[0] != "#N 512x512x100" || lines[1] != test.header {
+				t.Errorf("expected a name and header line, got %q and %q", lines[0], lines[1])
+			}
+			for _, line := range lines[2:] {
+				if len(line) > 70 {
+					t.Fatalf("line of %d characters is longer than 70", len(line))
+				}
+			}
+			if !strings.HasSuffix(lines[len(lines)-1], "!") {
+				t.Error("expected the pattern to end with !")
+			}
+
+			p = gol.Params{Turns: 0, Threads: 8, ImageWidth: 512, ImageHeight: 512, Rule: test.rule, Input: "out/512x512x100.rle"}
+			assertEqualBoard(t, runFinal(p), expected, p)
+		})
+	}
+}
+
+// TestRleLargerThanLife checks that a pattern saved under a Larger than Life rule, whose header has commas in
+// the rule, loads again with that rule.
+func TestRleLargerThanLife(t *testing.T) {
+	rule := "R2,C0,M0,S3..5,B3..4,NN"
+	p := gol.Params{Turns: 10, Threads: 4, ImageWidth: 64, ImageHeight: 64, Rule: rule, OutputFormat: "rle"}
+	expected := runFinal(p)
+	assertEqualBoard(t, expected, readAliveCells("check/rules/R2C0M0S35B34NN/64x64x10.pgm", 64, 64), p)
+
+	//With no rule of its own, the rest of the run has to use the rule in the header to match 30 turns
+	p = gol.Params{Turns: 20, Threads: 4, ImageWidth: 64, ImageHeight: 64, Input: "out/64x64x10.rle"}
+	assertEqualBoard(t, runFinal(p), readAliveCells("check/rules/R2C0M0S35B34NN/64x64x30.pgm", 64, 64), p)
+}
+
+// TestInvalidFormat checks that gol.Run rejects unknown input and output formats.
+func TestInvalidFormat(t *testing.T) {
+	for _, p := range []gol.Params{
+		{Input: "images/16x16.png"},
+		{OutputFormat: "png"},
+		{Input: "check/rle/missing.rle"},
+	} {
+		p.Turns, p.Threads, p.ImageWidth, p.ImageHeight = 1, 1, 16, 16
+		events := make(chan gol.Event)
+		if err := gol.Run(p, events, nil); err == nil {
+			t.Errorf("expected an error for %+v", p)
+		}
+		if _, ok := <-events; ok {
+			t.Error("expected events to be closed")
+		}
+	}
+}
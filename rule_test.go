@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestRules tests 16x16 and 64x64 images on 1, 10 and 100 turns under non-Conway rules, given in
+// both B/S and legacy S/B notation, using 1-8 worker threads.
+func TestRules(t *testing.T) {
+	rules := map[string]string{
+		"B36/S23":      "23/36",      // HighLife
+		"B3678/S34678": "34678/3678", // Day & Night
+		"B2/S":         "/2",         // Seeds
+		"B36/S125":     "125/36",     // 2x2
+	}
+	tests := []gol.Params{
+		{ImageWidth: 16, ImageHeight: 16},
+		{ImageWidth: 64, ImageHeight: 64},
+	}
+	for bs, sb := range rules {
+		for _, p := range tests {
+			for _, turns := range []int{1, 10, 100} {
+				p.Turns = turns
+				expectedAlive := readAliveCells(
+					"check/rules/"+strings.Replace(bs, "/", "", -1)+fmt.Sprintf("/%vx%vx%v.pgm", p.ImageWidth, p.ImageHeight, turns),
+					p.ImageWidth,
+					p.ImageHeight,
+				)
+				for _, rule := range []string{bs, sb} {
+					p.Rule = rule
+					for threads := 1; threads <= 8; threads++ {
+						p.Threads = threads
+						testName := fmt.Sprintf("%s/%dx%dx%d-%d", rule, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+						t.Run(testName, func(t *testing.T) {
+							events := make(chan gol.Event)
+							go gol.Run(p, events, nil)
+							var cells []util.Cell
+							for event := range events {
+								switch e := event.(type) {
+								case gol.FinalTurnComplete:
+									cells = e.Alive
+								}
+							}
+							assertEqualBoard(t, cells, expectedAlive, p)
+						})
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestInvalidRule checks that gol.Run rejects malformed rules and closes the events channel.
+func TestInvalidRule(t *testing.T) {
+	for _, rule := range []string{"B9/S23", "B3/S23/X", "B3", "23/3/6/2", "B2/S/C1", "R8,C0,M0,S1..2,B1..2,NM", "R2,S1..2", "conway"} {
+		t.Run(rule, func(t *testing.T) {
+			p := gol.Params{Turns: 1, Threads: 1, ImageWidth: 16, ImageHeight: 16, Rule: rule}
+			events := make(chan gol.Event)
+			err := gol.Run(p, events, nil)
+			if err == nil {
+				t.Fatalf("expected an error for rule %q", rule)
+			}
+			if _, ok := <-events; ok {
+				t.Fatal("expected events to be closed")
+			}
+		})
+	}
+}
@@ -6,9 +6,22 @@ import (
 	"uk.ac.bris.cs/gameoflife/gol"
 )
 
-func Run(p gol.Params, events <-chan gol.Event, keyPresses chan<- rune) {
+// Run shows the events of a run in a window until it finishes, and controls the run with the keys that
+// are pressed: p pauses and resumes it, n and f step it by a turn or p.FastForward turns while it is paused
+// and b steps it back a turn, s saves the world, q quits and k kills the run. The window is rendered after
+// every turn it steps by.
+func Run(p gol.Params, events <-chan gol.Event, c *gol.Controller) {
 	w := NewWindow(int32(p.ImageWidth), int32(p.ImageHeight))
 
+	//The run may be waiting for the window to take its events, so it is controlled from another goroutine
+	controls := make(chan func(), 10)
+	defer close(controls)
+	go func() {
+		for control := range controls {
+			control()
+		}
+	}()
+
 sdlLoop:
 	for {
 		event := w.PollEvent()
@@ -17,13 +30,27 @@ sdlLoop:
 			case *sdl.KeyboardEvent:
 				switch e.Keysym.Sym {
 				case sdl.K_p:
-					keyPresses <- 'p'
+					controls <- func() {
+						if _, err := c.Pause(); err == gol.ErrPaused {
+							c.Resume()
+						}
+					}
+				case sdl.K_n:
+					controls <- func() { c.Press('n') }
+				case sdl.K_f:
+					controls <- func() { c.Press('f') }
+				case sdl.K_b:
+					controls <- func() { c.Press('b') }
 				case sdl.K_s:
-					keyPresses <- 's'
+					controls <- func() {
+						if _, err := c.Save(""); err != nil && err != gol.ErrFinished {
+							fmt.Println(err)
+						}
+					}
 				case sdl.K_q:
-					keyPresses <- 'q'
+					controls <- func() { c.Quit() }
 				case sdl.K_k:
-					keyPresses <- 'k'
+					controls <- func() { c.Kill() }
 				}
 			}
 		}
@@ -35,7 +62,21 @@ sdlLoop:
 			}
 			switch e := event.(type) {
 			case gol.CellFlipped:
+				//An unbounded universe is only drawn where it overlaps the image it started from
+				if p.Unbounded && !w.Contains(e.Cell.X, e.Cell.Y) {
+					break
+				}
 				w.FlipPixel(e.Cell.X, e.Cell.Y)
+			case gol.CellsFlipped:
+				for _, cell := range e.Cells {
+					if p.Unbounded && !w.Contains(cell.X, cell.Y) {
+						continue
+					}
+					w.FlipPixel(cell.X, cell.Y)
+				}
+			case gol.CellStateChanged:
+				r, g, b := stateColour(e.State)
+				w.SetPixelColour(e.Cell.X, e.Cell.Y, r, g, b)
 			case gol.TurnComplete:
 				w.RenderFrame()
 			case gol.FinalTurnComplete:
@@ -52,3 +93,17 @@ sdlLoop:
 	}
 
 }
+
+// stateColour returns the colour to draw a cell in the given state: dead cells are black, alive cells
+// are white, and dying cells fade from orange towards dark red the longer they have been dying.
+func stateColour(state uint8) (r, g, b uint8) {
+	switch state {
+	case 0:
+		return 0, 0, 0
+	case 1:
+		return 0xFF, 0xFF, 0xFF
+	default:
+		fade := 0xFF / int(state-1)
+		return uint8(0x40 + fade*3/4), uint8(fade / 2), 0
+	}
+}
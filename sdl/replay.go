@@ -0,0 +1,156 @@
+package sdl
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// Playback is how Replay plays back a recording in a window.
+type Playback struct {
+	// X, Y, Width and Height are the top left cell and the size of the part of the world shown in the
+	// window. Cells outside it aren't drawn.
+	X, Y, Width, Height int
+
+	// FramesPerSecond is how many frames are shown every second while the recording is playing.
+	FramesPerSecond float64
+
+	// Turn is the turn to start playing from, as for gol.Recording.Seek.
+	Turn int
+}
+
+// Replay plays back a recording of a run in a window until q is pressed, without running it again. p pauses
+// and resumes it, r reverses the direction it plays in, and = and - double and halve its speed. While it is
+// paused, n and the right arrow step it forward by a frame, and b and the left arrow step it back. Typing a
+// turn and pressing return seeks to it, and home and end seek to the start and the end. It pauses once it
+// reaches either end.
+func Replay(r *gol.Recording, p Playback) {
+	w := NewWindow(int32(p.Width), int32(p.Height))
+	defer w.Destroy()
+
+	//draw draws the events that take the window from one frame to another, printing the others as Run does
+	//if verbose is set
+	draw := func(events []gol.Event, verbose bool) {
+		for _, event := range events {
+			switch e := event.(type) {
+			case gol.CellsFlipped:
+				for _, cell := range e.Cells {
+					if w.Contains(cell.X-p.X, cell.Y-p.Y) {
+						w.FlipPixel(cell.X-p.X, cell.Y-p.Y)
+					}
+				}
+			case gol.CellStateChanged:
+				if w.Contains(e.Cell.X-p.X, e.Cell.Y-p.Y) {
+					red, green, blue := stateColour(e.State)
+					w.SetPixelColour(e.Cell.X-p.X, e.Cell.Y-p.Y, red, green, blue)
+				}
+			case gol.TurnComplete:
+			default:
+				if verbose && len(event.String()) > 0 {
+					fmt.Printf("Completed Turns %-8v%v\n", event.GetCompletedTurns(), event)
+				}
+			}
+		}
+	}
+	//seek steps through every frame up to frame i, and only renders the last
+	frame, last := -1, r.Frames()-1
+	seek := func(i int) {
+		for frame < i {
+			frame++
+			draw(r.Frame(frame), frame == i)
+		}
+		for frame > i {
+			draw(r.Back(frame), false)
+			frame--
+		}
+		w.RenderFrame()
+	}
+	announce := func(state string) {
+		fmt.Printf("Completed Turns %-8v%v\n", r.Turn(frame), state)
+	}
+
+	seek(r.Seek(p.Turn))
+	playing, forward := true, true
+	interval := time.Duration(float64(time.Second) / p.FramesPerSecond)
+	ticker := time.NewTicker(interval)
+	defer func() { ticker.Stop() }()
+	//turn is the turn being typed in to seek to, if typing is set
+	turn, typing := 0, false
+
+	for {
+		if e, ok := w.PollEvent().(*sdl.KeyboardEvent); ok {
+			key := e.Keysym.Sym
+			if key >= sdl.K_0 && key <= sdl.K_9 {
+				turn, typing = turn*10+int(key-sdl.K_0), true
+			}
+			switch key {
+			case sdl.K_p:
+				playing = !playing
+				if playing {
+					announce("Playing")
+				} else {
+					announce("Paused")
+				}
+			case sdl.K_r:
+				forward = !forward
+				if forward {
+					announce("Playing forward")
+				} else {
+					announce("Playing in reverse")
+				}
+			case sdl.K_EQUALS, sdl.K_MINUS:
+				if key == sdl.K_EQUALS && interval > time.Millisecond {
+					interval /= 2
+				} else if key == sdl.K_MINUS {
+					interval *= 2
+				}
+				ticker.Stop()
+				ticker = time.NewTicker(interval)
+				fmt.Printf("%.4g frames per second\n", float64(time.Second)/float64(interval))
+			case sdl.K_n, sdl.K_RIGHT:
+				if !playing && frame < last {
+					seek(frame + 1)
+				}
+			case sdl.K_b, sdl.K_LEFT:
+				if !playing && frame > 0 {
+					seek(frame - 1)
+				}
+			case sdl.K_BACKSPACE:
+				turn /= 10
+			case sdl.K_RETURN:
+				if typing {
+					seek(r.Seek(turn))
+					announce("Seeked")
+				}
+				turn, typing = 0, false
+			case sdl.K_HOME:
+				seek(0)
+				announce("Seeked")
+			case sdl.K_END:
+				seek(last)
+				announce("Seeked")
+			case sdl.K_q:
+				return
+			}
+		}
+		select {
+		case <-ticker.C:
+			if !playing {
+				break
+			}
+			switch {
+			case forward && frame < last:
+				seek(frame + 1)
+			case !forward && frame > 0:
+				seek(frame - 1)
+			default:
+				playing = false
+				announce("Paused")
+			}
+		default:
+			break
+		}
+	}
+}
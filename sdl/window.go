@@ -75,6 +75,24 @@ func (w *Window) SetPixel(x, y int) {
 	w.pixels[4*(y*width+x)+3] = 0xFF
 }
 
+// SetPixelColour sets the colour of a single pixel, used for cells that are neither dead nor alive.
+func (w *Window) SetPixelColour(x, y int, r, g, b uint8) {
+	if x < 0 || y < 0 || x >= int(w.Width) || y >= int(w.Height) {
+		panic(fmt.Sprintf("CellStateChanged event at (%d, %d) is outside the bounds of the window.", x, y))
+	}
+
+	width := int(w.Width)
+	w.pixels[4*(y*width+x)+0] = b
+	w.pixels[4*(y*width+x)+1] = g
+	w.pixels[4*(y*width+x)+2] = r
+	w.pixels[4*(y*width+x)+3] = 0xFF
+}
+
+// Contains reports whether the pixel at (x, y) is inside the window.
+func (w *Window) Contains(x, y int) bool {
+	return x >= 0 && y >= 0 && x < int(w.Width) && y < int(w.Height)
+}
+
 func (w *Window) FlipPixel(x, y int) {
 	if x < 0 || y < 0 || x >= int(w.Width) || y >= int(w.Height) {
 		panic(fmt.Sprintf("CellFlipped event at (%d, %d) is outside the bounds of the window.", x, y))
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestServer serves a 64x64 world on loopback, and checks that a controller attaching to it is sent the
+// world at the current turn before the turns after it, that the world carries on while no controller is
+// attached, and that 'k' writes the final world and shuts the server down.
+func TestServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := gol.Params{Turns: 1000000000, Threads: 2, ImageWidth: 64, ImageHeight: 64}
+	served := make(chan error, 1)
+	go func() {
+		served <- gol.Serve(l, p)
+	}()
+
+	//Attach, check the world it was attached on and 10 turns after it, then detach
+	lastTurn := 0
+	for i := 0; i < 2; i++ {
+		c := attach(t, l.Addr().String())
+		alive, turn := c.nextTurn(t)
+		if turn < lastTurn {
+			t.Fatalf("attached on turn %d after detaching on turn %d", turn, lastTurn)
+		}
+		assertEqualBoard(t, alive, runFinal(gol.Params{Turns: turn, Threads: 2, ImageWidth: 64, ImageHeight: 64}), p)
+		for attachedOn := turn; turn < attachedOn+10; {
+			alive, turn = c.nextTurn(t)
+		}
+		assertEqualBoard(t, alive, runFinal(gol.Params{Turns: turn, Threads: 2, ImageWidth: 64, ImageHeight: 64}), p)
+		if c.Params.ImageWidth != 64 || c.Params.Turns != p.Turns {
+			t.Errorf("attached with params %+v, expected %+v", c.Params, p)
+		}
+		c.detach(t, false)
+		lastTurn = turn
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	//Attach again, control the run on the server, and kill it
+	c := attach(t, l.Addr().String())
+	if _, turn := c.nextTurn(t); turn <= lastTurn {
+		t.Errorf("the world stayed on turn %d while no controller was attached", lastTurn)
+	}
+	//The server queues the events the controller doesn't take yet, so commands don't wait for them
+	if _, err := c.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Pause(); err != gol.ErrPaused {
+		t.Errorf("expected %v pausing a paused server, got %v", gol.ErrPaused, err)
+	}
+	turn, err := c.Step(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alive, snapshotTurn, err := c.Snapshot()
+	if err != nil || snapshotTurn != turn {
+		t.Fatalf("snapshot of turn %d after stepping to turn %d: %v", snapshotTurn, turn, err)
+	}
+	assertEqualBoard(t, alive, runFinal(gol.Params{Turns: turn, Threads: 2, ImageWidth: 64, ImageHeight: 64}), p)
+	if _, err := c.Resume(); err != nil {
+		t.Error(err)
+	}
+	var final gol.FinalTurnComplete
+	for _, event := range c.detach(t, true) {
+		if e, ok := event.(gol.FinalTurnComplete); ok {
+			final = e
+		}
+	}
+	assertEqualBoard(t, final.Alive, runFinal(gol.Params{Turns: final.CompletedTurns, Threads: 2, ImageWidth: 64, ImageHeight: 64}), p)
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the server didn't shut down after 'k'")
+	}
+	output := fmt.Sprintf("out/64x64x%d.pgm", final.CompletedTurns)
+	if _, err := os.Stat(output); err != nil {
+		t.Errorf("the final world wasn't written: %v", err)
+	}
+	if _, _, err := gol.Attach(context.Background(), l.Addr().String(), make(chan gol.Event)); err == nil {
+		t.Error("attached to a server that had shut down")
+	}
+}
+
+// TestServerBusy checks that a second controller can't attach to a server until the first has detached.
+func TestServerBusy(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go gol.Serve(l, gol.Params{Turns: 1000000000, Threads: 2, ImageWidth: 16, ImageHeight: 16})
+
+	c := attach(t, l.Addr().String())
+	if _, _, err := gol.Attach(context.Background(), l.Addr().String(), make(chan gol.Event)); err == nil {
+		t.Error("a second controller attached while the first was attached")
+	}
+	c.detach(t, false)
+	attach(t, l.Addr().String()).detach(t, true)
+}
+
+// TestServerBroker serves a 64x64 world on a broker, asking for a headless run as a server without a window
+// would, and checks that a controller attaching to it later is sent the world at the current turn.
+func TestServerBroker(t *testing.T) {
+	broker, stop := startCluster(t, 2, nil)
+	defer stop()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := gol.Params{Turns: 1000000000, Threads: 1, ImageWidth: 64, ImageHeight: 64, Broker: broker, Headless: true}
+	go gol.Serve(l, p)
+	time.Sleep(200 * time.Millisecond)
+
+	c := attach(t, l.Addr().String())
+	alive, turn := c.nextTurn(t)
+	if turn == 0 {
+		t.Error("attached before the world had progressed")
+	}
+	assertEqualBoard(t, alive, runFinal(gol.Params{Turns: turn, Threads: 2, ImageWidth: 64, ImageHeight: 64}), p)
+	c.detach(t, true)
+}
+
+// controller is a controller attached to a server, which follows the world it is sent.
+type controller struct {
+	*gol.Controller
+	Params gol.Params
+	events chan gol.Event
+	alive  map[util.Cell]bool
+}
+
+// attach attaches to the server at address.
+func attach(t *testing.T, address string) *controller {
+	events := make(chan gol.Event, 1000)
+	c, p, err := gol.Attach(context.Background(), address, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &controller{c, p, events, make(map[util.Cell]bool)}
+}
+
+// nextTurn follows the CellsFlipped events sent to the controller up to the next TurnComplete, and returns
+// the alive cells and the turn it completes.
+func (c *controller) nextTurn(t *testing.T) ([]util.Cell, int) {
+	for event := range c.events {
+		switch e := event.(type) {
+		case gol.CellsFlipped:
+			for _, cell := range e.Cells {
+				c.alive[cell] = !c.alive[cell]
+			}
+		case gol.TurnComplete:
+			var cells []util.Cell
+			for cell, isAlive := range c.alive {
+				if isAlive {
+					cells = append(cells, cell)
+				}
+			}
+			return cells, e.CompletedTurns
+		}
+	}
+	t.Fatal("events closed before a turn was completed")
+	return nil, 0
+}
+
+// detach ends the attachment by quitting, or killing the server if kill is set, and returns the events
+// that were sent before it ended.
+func (c *controller) detach(t *testing.T, kill bool) []gol.Event {
+	var events []gol.Event
+	received := make(chan bool)
+	go func() {
+		for event := range c.events {
+			events = append(events, event)
+		}
+		close(received)
+	}()
+	end := c.Quit
+	if kill {
+		end = c.Kill
+	}
+	if err := end(); err != nil {
+		t.Error(err)
+	}
+	<-received
+	return events
+}
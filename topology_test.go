@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestTopologies tests 16x16 and 64x64 images on 1, 10 and 100 turns on every topology other than the torus
+// (which TestGol covers), plus a 64x64 image on 10 turns under a Larger than Life rule, using 1-8 worker threads.
+func TestTopologies(t *testing.T) {
+	type test struct {
+		params gol.Params
+		golden string
+	}
+	var tests []test
+	for _, topology := range []gol.Topology{gol.Plane, gol.Cylinder, gol.KleinBottle, gol.CrossSurface} {
+		for _, size := range []int{16, 64} {
+			for _, turns := range []int{1, 10, 100} {
+				tests = append(tests, test{
+					params: gol.Params{Turns: turns, ImageWidth: size, ImageHeight: size, Topology: topology},
+					golden: fmt.Sprintf("check/topologies/%v/%vx%vx%v.pgm", topology, size, size, turns),
+				})
+			}
+		}
+		if topology != gol.CrossSurface {
+			tests = append(tests, test{
+				params: gol.Params{Turns: 10, ImageWidth: 64, ImageHeight: 64, Topology: topology, Rule: "R2,C0,M0,S3..5,B3..4,NN"},
+				golden: fmt.Sprintf("check/topologies/%v/R2C0M0S35B34NN/64x64x10.pgm", topology),
+			})
+		}
+	}
+	for _, test := range tests {
+		p := test.params
+		expectedAlive := readAliveCells(test.golden, p.ImageWidth, p.ImageHeight)
+		for threads := 1; threads <= 8; threads++ {
+			p.Threads = threads
+			testName := fmt.Sprintf("%v/%s/%dx%dx%d-%d", p.Topology, p.Rule, p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+			t.Run(testName, func(t *testing.T) {
+				events := make(chan gol.Event)
+				go gol.Run(p, events, nil)
+				var cells []util.Cell
+				for event := range events {
+					switch e := event.(type) {
+					case gol.FinalTurnComplete:
+						cells = e.Alive
+					}
+				}
+				assertEqualBoard(t, cells, expectedAlive, p)
+			})
+		}
+	}
+}
+
+// TestInvalidTopology checks that gol.Run rejects unknown topologies, and Larger than Life rules on a cross-surface.
+func TestInvalidTopology(t *testing.T) {
+	if _, err := gol.ParseTopology("sphere"); err == nil {
+		t.Error("expected an error for topology \"sphere\"")
+	}
+	for _, p := range []gol.Params{
+		{Topology: gol.Topology(-1)},
+		{Topology: gol.CrossSurface, Rule: "R2,C0,M0,S3..5,B3..4,NN"},
+	} {
+		p.Turns, p.Threads, p.ImageWidth, p.ImageHeight = 1, 1, 16, 16
+		events := make(chan gol.Event)
+		if err := gol.Run(p, events, nil); err == nil {
+			t.Errorf("expected an error for %v topology with rule %q", p.Topology, p.Rule)
+		}
+		if _, ok := <-events; ok {
+			t.Error("expected events to be closed")
+		}
+	}
+}
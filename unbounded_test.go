@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// TestUnbounded tests 16x16 and 64x64 images on 1, 100 and 1000 turns in an unbounded universe using 1-8
+// worker threads. The expected images cover the bounding box of the alive cells, whose top left cell is at x, y.
+func TestUnbounded(t *testing.T) {
+	tests := []struct {
+		size, turns         int
+		x, y, width, height int
+	}{
+		{16, 1, 3, 6, 3, 3},
+		{16, 100, 28, 30, 3, 3},
+		{16, 1000, 253, 255, 3, 3},
+		{64, 1, 0, -1, 65, 66},
+		{64, 100, -6, -5, 81, 101},
+		{64, 1000, -181, -70, 440, 314},
+	}
+	for _, test := range tests {
+		p := gol.Params{Turns: test.turns, ImageWidth: test.size, ImageHeight: test.size, Unbounded: true}
+		golden := fmt.Sprintf("check/unbounded/%vx%vx%v.pgm", test.size, test.size, test.turns)
+		expectedImage := readPgmPixels(t, golden)
+		var expectedAlive []util.Cell
+		for _, cell := range readAliveCells(golden, test.width, test.height) {
+			expectedAlive = append(expectedAlive, util.Cell{X: cell.X + test.x, Y: cell.Y + test.y})
+		}
+		for threads := 1; threads <= 8; threads++ {
+			p.Threads = threads
+			testName := fmt.Sprintf("%dx%dx%d-%d", p.ImageWidth, p.ImageHeight, p.Turns, p.Threads)
+			t.Run(testName, func(t *testing.T) {
+				events := make(chan gol.Event)
+				go gol.Run(p, events, nil)
+				var cells []util.Cell
+				for event := range events {
+					switch e := event.(type) {
+					case gol.FinalTurnComplete:
+						cells = e.Alive
+					}
+				}
+				assertEqualBoard(t, cells, expectedAlive, p)
+
+				image := readPgmPixels(t, fmt.Sprintf("out/%vx%vx%v@%v,%v.pgm", test.height, test.width, test.turns, test.x, test.y))
+				if !bytes.Equal(image, expectedImage) {
+					t.Error("output image doesn't match the expected bounding box")
+				}
+			})
+		}
+	}
+}
+
+// TestUnboundedEvents checks that the CellsFlipped events of an unbounded universe, including those with
+// negative coordinates, add up to the final alive cells.
+func TestUnboundedEvents(t *testing.T) {
+	p := gol.Params{Turns: 100, Threads: 4, ImageWidth: 64, ImageHeight: 64, Unbounded: true}
+	events := make(chan gol.Event)
+	go gol.Run(p, events, nil)
+	alive := make(map[util.Cell]bool)
+	negative := false
+	var final []util.Cell
+	for event := range events {
+		switch e := event.(type) {
+		case gol.CellsFlipped:
+			for _, cell := range e.Cells {
+				alive[cell] = !alive[cell]
+				negative = negative || cell.X < 0 || cell.Y < 0
+			}
+		case gol.FinalTurnComplete:
+			final = e.Alive
+		}
+	}
+	var flipped []util.Cell
+	for cell, isAlive := range alive {
+		if isAlive {
+			flipped = append(flipped, cell)
+		}
+	}
+	if !negative {
+		t.Error("expected cells with negative coordinates")
+	}
+	assertEqualBoard(t, flipped, final, p)
+}
+
+// TestInvalidUnbounded checks that gol.Run rejects unbounded universes with rules or topologies they can't support.
+func TestInvalidUnbounded(t *testing.T) {
+	for _, p := range []gol.Params{
+		{Rule: "B2/S/C3"},
+		{Rule: "R2,C0,M0,S3..5,B3..4,NN"},
+		{Rule: "B01/S23"},
+		{Topology: gol.KleinBottle},
+	} {
+		p.Turns, p.Threads, p.ImageWidth, p.ImageHeight, p.Unbounded = 1, 1, 16, 16, true
+		events := make(chan gol.Event)
+		if err := gol.Run(p, events, nil); err == nil {
+			t.Errorf("expected an error for rule %q on a %v", p.Rule, p.Topology)
+		}
+		if _, ok := <-events; ok {
+			t.Error("expected events to be closed")
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package web
+
+// page draws the world on a canvas from the messages sent over the WebSocket at /ws, colouring cells as the
+// SDL window does, and sends back the keys that are pressed on it.
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Game of Life</title>
+<style>
+body { background: #111; color: #ddd; font-family: monospace; }
+canvas { image-rendering: pixelated; border: 1px solid #444; }
+</style>
+</head>
+<body>
+<canvas id="world" width="0" height="0"></canvas>
+<p id="status">Connecting</p>
+<p>p pauses and resumes, n and f step a paused run, b steps it back, s saves, q quits and k kills the run.</p>
+<pre id="log"></pre>
+<script>
+"use strict";
+const canvas = document.getElementById("world");
+const context = canvas.getContext("2d");
+const status = document.getElementById("status");
+const log = document.getElementById("log");
+let image = null;
+
+function colour(state) {
+	if (state === 0) {
+		return [0, 0, 0];
+	}
+	if (state === 1) {
+		return [255, 255, 255];
+	}
+	const fade = Math.floor(255 / (state - 1));
+	return [0x40 + Math.floor(fade * 3 / 4), Math.floor(fade / 2), 0];
+}
+
+function pixel(x, y) {
+	if (x < 0 || y < 0 || x >= image.width || y >= image.height) {
+		return -1;
+	}
+	return 4 * (y * image.width + x);
+}
+
+const socket = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + "/ws");
+socket.onmessage = (event) => {
+	const m = JSON.parse(event.data);
+	if (m.Width) {
+		canvas.width = m.Width;
+		canvas.height = m.Height;
+		const scale = Math.max(1, Math.floor(512 / Math.max(m.Width, m.Height)));
+		canvas.style.width = m.Width * scale + "px";
+		canvas.style.height = m.Height * scale + "px";
+		image = context.createImageData(m.Width, m.Height);
+		for (let i = 3; i < image.data.length; i += 4) {
+			image.data[i] = 255;
+		}
+	}
+	const flip = m.Flip || [];
+	for (let i = 0; i < flip.length; i += 2) {
+		const p = pixel(flip[i], flip[i + 1]);
+		if (p >= 0) {
+			image.data[p] = 255 - image.data[p];
+			image.data[p + 1] = 255 - image.data[p + 1];
+			image.data[p + 2] = 255 - image.data[p + 2];
+		}
+	}
+	const states = m.States || [];
+	for (let i = 0; i < states.length; i += 3) {
+		const p = pixel(states[i], states[i + 1]);
+		if (p >= 0) {
+			const [r, g, b] = colour(states[i + 2]);
+			image.data[p] = r;
+			image.data[p + 1] = g;
+			image.data[p + 2] = b;
+		}
+	}
+	context.putImageData(image, 0, 0);
+	status.textContent = (m.Done ? "Finished after turn " : "Turn ") + m.Turn;
+	for (const line of m.Events || []) {
+		log.textContent = line + "\n" + log.textContent;
+	}
+};
+socket.onclose = () => {
+	if (!status.textContent.startsWith("Finished")) {
+		status.textContent += " (disconnected)";
+	}
+};
+document.onkeydown = (event) => {
+	if ("pnfbsqk".includes(event.key) && socket.readyState === WebSocket.OPEN) {
+		socket.send(event.key);
+	}
+};
+</script>
+</body>
+</html>
+`
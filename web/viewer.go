@@ -0,0 +1,239 @@
+// Package web shows runs of the Game of Life in a browser, for machines without a display for the SDL
+// window: a page draws the world on a canvas from the changes streamed to it over a WebSocket, and sends
+// back the keys that are pressed on it.
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+)
+
+// drainTimeout is how long a browser has to take each message, and so the last messages of a run.
+const drainTimeout = 5 * time.Second
+
+// maxPendingEvents is the most events, other than those for cells, that are kept for a browser that has
+// fallen behind. Older ones are dropped.
+const maxPendingEvents = 100
+
+// keys are the keys that a browser can press on the run, as on the SDL window (see gol.Controller.Press).
+const keys = "pnfbsqk"
+
+// Viewer follows the events of a run to keep a copy of the world, and streams the changes to it to every
+// browser that connects, along with the world as it connects. A browser that falls behind is sent the
+// changes of the turns it missed together, so it never holds up the run.
+type Viewer struct {
+	mu      sync.Mutex
+	changed *sync.Cond // broadcast when an event arrives, a browser goes, or the run finishes
+	alive   map[util.Cell]bool
+	states  map[util.Cell]uint8
+	turn    int
+	clients map[*client]bool
+	done    bool // set once the run has sent its last event
+}
+
+// client is what a browser hasn't been sent yet.
+type client struct {
+	flipped map[util.Cell]bool // the cells flipped an odd number of times
+	states  map[util.Cell]uint8
+	turn    int
+	turned  bool     // whether a turn has been completed
+	events  []string // the other events, as the SDL window prints them
+	gone    bool     // set once the browser has disconnected
+}
+
+// message is sent to a browser with the changes to the world since the last one. The first also has the
+// size of the world.
+type message struct {
+	Width  int      `json:",omitempty"`
+	Height int      `json:",omitempty"`
+	Turn   int      // the number of turns completed
+	Flip   []int    // the x and y of every cell that flipped
+	States []int    // the x, y and state of every cell whose state changed under a Generations rule
+	Events []string `json:",omitempty"`
+	Done   bool     `json:",omitempty"` // set on the last message, once the run has finished
+}
+
+// NewViewer starts following the events of a run on bus, which must be subscribed to before the run starts
+// so that the initial world isn't missed.
+func NewViewer(bus *gol.Bus) *Viewer {
+	v := &Viewer{alive: make(map[util.Cell]bool), states: make(map[util.Cell]uint8), clients: make(map[*client]bool)}
+	v.changed = sync.NewCond(&v.mu)
+	//The copy of the world is quick to update, so the viewer doesn't miss any changes
+	events := make(chan gol.Event)
+	bus.Subscribe(events, gol.Subscription{Policy: gol.Block})
+	go v.follow(events)
+	return v
+}
+
+// follow applies every event to the copy of the world and to what each browser hasn't been sent yet.
+func (v *Viewer) follow(events <-chan gol.Event) {
+	for event := range events {
+		v.mu.Lock()
+		switch e := event.(type) {
+		case gol.CellFlipped:
+			v.flip(e.Cell)
+		case gol.CellsFlipped:
+			for _, cell := range e.Cells {
+				v.flip(cell)
+			}
+		case gol.CellStateChanged:
+			if e.State == 0 {
+				delete(v.states, e.Cell)
+			} else {
+				v.states[e.Cell] = e.State
+			}
+			for c := range v.clients {
+				c.states[e.Cell] = e.State
+			}
+		case gol.TurnComplete:
+			v.turn = e.CompletedTurns
+			for c := range v.clients {
+				c.turn, c.turned = e.CompletedTurns, true
+			}
+		default:
+			if len(event.String()) > 0 {
+				line := fmt.Sprintf("Completed Turns %-8v%v", event.GetCompletedTurns(), event)
+				for c := range v.clients {
+					if c.events = append(c.events, line); len(c.events) > maxPendingEvents {
+						c.events = c.events[1:]
+					}
+				}
+			}
+		}
+		v.changed.Broadcast()
+		v.mu.Unlock()
+	}
+	v.mu.Lock()
+	v.done = true
+	v.changed.Broadcast()
+	v.mu.Unlock()
+}
+
+// flip flips a cell of the copy of the world, and for every browser.
+func (v *Viewer) flip(cell util.Cell) {
+	if v.alive[cell] {
+		delete(v.alive, cell)
+	} else {
+		v.alive[cell] = true
+	}
+	for c := range v.clients {
+		if c.flipped[cell] {
+			delete(c.flipped, cell)
+		} else {
+			c.flipped[cell] = true
+		}
+	}
+}
+
+// Wait waits for the run to finish, and for every browser to be sent the last of its changes or go.
+func (v *Viewer) Wait() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for !v.done || len(v.clients) > 0 {
+		v.changed.Wait()
+	}
+}
+
+// Handler returns a handler that serves the page that shows the run of p at /, and the WebSocket it
+// connects to at /ws. The keys pressed on the page are pressed on c.
+func (v *Viewer) Handler(p gol.Params, c *gol.Controller) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, page)
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		v.serve(conn, p, c)
+	})
+	return mux
+}
+
+// serve streams the changes to the world to a browser until the run finishes or it disconnects, and
+// presses the keys it sends.
+func (v *Viewer) serve(conn *Conn, p gol.Params, c *gol.Controller) {
+	defer conn.Close()
+
+	//The browser is sent the whole world to begin with, as the cells flipped from an empty world
+	v.mu.Lock()
+	cl := &client{flipped: make(map[util.Cell]bool), states: make(map[util.Cell]uint8), turn: v.turn, turned: true}
+	for cell := range v.alive {
+		cl.flipped[cell] = true
+	}
+	for cell, state := range v.states {
+		cl.states[cell] = state
+	}
+	v.clients[cl] = true
+	v.mu.Unlock()
+	defer func() {
+		v.mu.Lock()
+		delete(v.clients, cl)
+		v.changed.Broadcast()
+		v.mu.Unlock()
+	}()
+
+	go func() {
+		for {
+			keyPresses, err := conn.ReadMessage()
+			if err != nil {
+				v.mu.Lock()
+				cl.gone = true
+				v.changed.Broadcast()
+				v.mu.Unlock()
+				return
+			}
+			for _, key := range string(keyPresses) {
+				if strings.ContainsRune(keys, key) {
+					c.Press(key)
+				}
+			}
+		}
+	}()
+
+	m := message{Width: p.ImageWidth, Height: p.ImageHeight}
+	for {
+		v.mu.Lock()
+		for !cl.turned && len(cl.events) == 0 && !v.done && !cl.gone {
+			v.changed.Wait()
+		}
+		if cl.gone {
+			v.mu.Unlock()
+			return
+		}
+		m.Turn, m.Events, m.Done = cl.turn, cl.events, v.done
+		m.Flip, m.States = make([]int, 0, 2*len(cl.flipped)), make([]int, 0, 3*len(cl.states))
+		for cell := range cl.flipped {
+			m.Flip = append(m.Flip, cell.X, cell.Y)
+		}
+		for cell, state := range cl.states {
+			m.States = append(m.States, cell.X, cell.Y, int(state))
+		}
+		cl.flipped, cl.states = make(map[util.Cell]bool), make(map[util.Cell]uint8)
+		cl.turned, cl.events = false, nil
+		v.mu.Unlock()
+
+		data, err := json.Marshal(m)
+		if err == nil {
+			conn.SetWriteDeadline(time.Now().Add(drainTimeout))
+			err = conn.WriteMessage(data)
+		}
+		if err != nil || m.Done {
+			return
+		}
+		m = message{}
+	}
+}
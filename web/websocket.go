@@ -0,0 +1,286 @@
+package web
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// websocketGUID is appended to the key of a WebSocket handshake to accept it (RFC 6455, section 1.3).
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// The opcodes of the frames of a WebSocket message.
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xA
+)
+
+// maxServerMessage is the longest message a server reads from a browser, which only sends keys.
+const maxServerMessage = 4096
+
+// maxClientMessage is the longest message a client reads from a server, which sends the whole world as a
+// client connects.
+const maxClientMessage = 1 << 30
+
+// Conn is a WebSocket connection, which only supports the parts of RFC 6455 that a viewer needs: text and
+// binary messages in any number of frames, pings and closing the connection, without extensions.
+// Messages can be read from one goroutine while they are written from others.
+type Conn struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	client bool // whether this is the client end, which masks the frames it writes
+	max    int  // the longest message that is read
+
+	mu     sync.Mutex // held while a frame is written
+	closed bool       // set once a close frame has been written
+}
+
+// accept returns the Sec-WebSocket-Accept header that accepts a handshake with key.
+func accept(key string) string {
+	h := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// hasToken reports whether a comma separated header holds token, which is case insensitive.
+func hasToken(header http.Header, name, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameOrigin reports whether a handshake comes from a page served by the host it was sent to. Browsers send
+// the origin of the page with every handshake, so any other page could otherwise connect, while other
+// clients don't send one.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// Upgrade completes the WebSocket handshake of a request, and returns the connection it was made on. If
+// the request isn't a handshake, it replies with 400 Bad Request and returns an error, and if it comes from
+// a page served by another host, it replies with 403 Forbidden.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || !hasToken(r.Header, "Connection", "upgrade") ||
+		!hasToken(r.Header, "Upgrade", "websocket") || r.Header.Get("Sec-WebSocket-Version") != "13" || key == "" {
+		http.Error(w, "expected a WebSocket handshake", http.StatusBadRequest)
+		return nil, errors.New("websocket: expected a handshake")
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "the origin of the handshake isn't this host", http.StatusForbidden)
+		return nil, fmt.Errorf("websocket: handshake from the origin %q", r.Header.Get("Origin"))
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "the connection can't be upgraded", http.StatusInternalServerError)
+		return nil, errors.New("websocket: the connection can't be hijacked")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("websocket: %v", err)
+	}
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + accept(key) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("websocket: %v", err)
+	}
+	return &Conn{conn: conn, r: rw.Reader, max: maxServerMessage}, nil
+}
+
+// Dial connects to the WebSocket server at a ws:// URL.
+func Dial(rawurl string) (*Conn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("websocket: %v", err)
+	}
+	if u.Scheme != "ws" {
+		return nil, fmt.Errorf("websocket: unsupported scheme %q, expected ws", u.Scheme)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host += ":80"
+	}
+	conn, err := net.Dial("tcp", host)
+	if err != nil {
+		return nil, fmt.Errorf("websocket: %v", err)
+	}
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n", u.RequestURI(), u.Host)
+	fmt.Fprintf(conn, "Sec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", key)
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err == nil && (resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != accept(key)) {
+		err = fmt.Errorf("handshake refused with %v", resp.Status)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("websocket: %v", err)
+	}
+	return &Conn{conn: conn, r: r, client: true, max: maxClientMessage}, nil
+}
+
+// ReadMessage returns the next text or binary message, replying to any pings before it. It returns io.EOF
+// once the other end has closed the connection.
+func (c *Conn) ReadMessage() ([]byte, error) {
+	var message []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case opClose:
+			c.writeFrame(opClose, payload)
+			return nil, io.EOF
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		}
+		message = append(message, payload...)
+		if len(message) > c.max {
+			return nil, fmt.Errorf("websocket: message longer than %d bytes", c.max)
+		}
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// readFrame reads a frame and unmasks its payload. It returns an error if the frame breaks RFC 6455, after
+// which the connection must be closed: frames from a client must be masked and those from a server must
+// not be, and control frames can't be fragmented or longer than 125 bytes.
+func (c *Conn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(c.r, header[:]); err != nil {
+		return
+	}
+	fin, opcode = header[0]&0x80 != 0, header[0]&0x0F
+	masked, length := header[1]&0x80 != 0, uint64(header[1]&0x7F)
+	switch {
+	case masked && c.client:
+		return false, 0, nil, errors.New("websocket: masked frame from the server")
+	case !masked && !c.client:
+		return false, 0, nil, errors.New("websocket: unmasked frame from the client")
+	case opcode&0x8 != 0 && (!fin || length > 125):
+		return false, 0, nil, errors.New("websocket: fragmented or long control frame")
+	}
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err = io.ReadFull(c.r, extended[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err = io.ReadFull(c.r, extended[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if length > uint64(c.max) {
+		return false, 0, nil, fmt.Errorf("websocket: frame longer than %d bytes", c.max)
+	}
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.r, mask[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.r, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return
+}
+
+// WriteMessage writes a text message.
+func (c *Conn) WriteMessage(message []byte) error {
+	return c.writeFrame(opText, message)
+}
+
+// writeFrame writes a whole message as a single frame, masked if this is the client end.
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errors.New("websocket: the connection is closed")
+	}
+	c.closed = opcode == opClose
+
+	frame := []byte{0x80 | opcode, 0}
+	switch {
+	case len(payload) < 126:
+		frame[1] = byte(len(payload))
+	case len(payload) <= 0xFFFF:
+		frame[1] = 126
+		frame = append(frame, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	default:
+		frame[1] = 127
+		frame = append(frame, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(frame[2:], uint64(len(payload)))
+	}
+	if c.client {
+		//Clients mask every frame with a new key, so that caches along the way don't mistake it for HTTP
+		frame[1] |= 0x80
+		var mask [4]byte
+		rand.Read(mask[:])
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := range frame[start:] {
+			frame[start+i] ^= mask[i%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// SetWriteDeadline sets the time by which writes must have finished, after which they fail.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// Close sends a close frame if one hasn't been sent, and closes the connection.
+func (c *Conn) Close() error {
+	c.writeFrame(opClose, nil)
+	return c.conn.Close()
+}
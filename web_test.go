@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+	"uk.ac.bris.cs/gameoflife/util"
+	"uk.ac.bris.cs/gameoflife/web"
+)
+
+// browserMessage is the message a browser is sent with the changes to the world.
+type browserMessage struct {
+	Width, Height int
+	Turn          int
+	Flip          []int
+	States        []int
+	Events        []string
+	Done          bool
+}
+
+// tab follows the world a run shows in a browser tab over a WebSocket.
+type tab struct {
+	conn  *web.Conn
+	alive map[util.Cell]bool
+	turn  int
+}
+
+// openTab connects to the WebSocket of the viewer served by srv, and reads the world it is sent.
+func openTab(t *testing.T, srv *httptest.Server, p gol.Params) *tab {
+	conn, err := web.Dial("ws" + strings.TrimPrefix(srv.URL, "http") + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &tab{conn: conn, alive: make(map[util.Cell]bool)}
+	if m := b.next(t); m.Width != p.ImageWidth || m.Height != p.ImageHeight {
+		t.Fatalf("expected the size %dx%d, got %dx%d", p.ImageWidth, p.ImageHeight, m.Width, m.Height)
+	}
+	return b
+}
+
+// next reads a message, and applies its changes to the world.
+func (b *tab) next(t *testing.T) browserMessage {
+	data, err := b.conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m browserMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(m.Flip); i += 2 {
+		cell := util.Cell{X: m.Flip[i], Y: m.Flip[i+1]}
+		b.alive[cell] = !b.alive[cell]
+	}
+	b.turn = m.Turn
+	return m
+}
+
+// until reads messages until one has an event containing text, and returns it.
+func (b *tab) until(t *testing.T, text string) browserMessage {
+	for {
+		m := b.next(t)
+		for _, event := range m.Events {
+			if strings.Contains(event, text) {
+				return m
+			}
+		}
+		if m.Done {
+			t.Fatalf("the run finished before %q", text)
+		}
+	}
+}
+
+// cells returns the alive cells of the world.
+func (b *tab) cells() []util.Cell {
+	var cells []util.Cell
+	for cell, isAlive := range b.alive {
+		if isAlive {
+			cells = append(cells, cell)
+		}
+	}
+	return cells
+}
+
+// TestWebViewer serves a 64x64 run to browsers with httptest, and checks that the page is served, that a
+// browser sees the same world as a snapshot once it pauses the run with p, that a browser that connects
+// later is sent the whole world, that one that never reads doesn't hold up the run, and that q quits it.
+// Handshakes from other origins and unmasked frames are refused.
+func TestWebViewer(t *testing.T) {
+	p := gol.Params{Turns: 1000000000, Threads: 4, ImageWidth: 64, ImageHeight: 64}
+	events := make(chan gol.Event, 1000)
+	bus := gol.NewBus(events)
+	viewer := web.NewViewer(bus)
+	c, err := gol.Start(context.Background(), p, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(viewer.Handler(p, c))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "<canvas") {
+		t.Errorf("expected the page, got %v: %s", resp.Status, body)
+	}
+	if resp, err := http.Get(srv.URL + "/ws"); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected a request without a handshake to be refused, got %v, %v", resp, err)
+	}
+
+	//Neither a page served by another host nor a client that doesn't mask its frames can press keys
+	handshake := http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}, "Sec-Websocket-Version": {"13"},
+		"Sec-Websocket-Key": {"dGhlIHNhbXBsZSBub25jZQ=="}}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/ws", nil)
+	req.Header = handshake
+	req.Header.Set("Origin", "http://example.com")
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected a handshake from another origin to be forbidden, got %v, %v", resp, err)
+	}
+	handshake.Del("Origin")
+	raw, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(raw, "GET /ws HTTP/1.1\r\nHost: %s\r\n", srv.Listener.Addr())
+	handshake.Write(raw)
+	fmt.Fprintf(raw, "\r\n%s", []byte{0x81, 1, 'k'})
+	raw.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, err := ioutil.ReadAll(raw); err != nil {
+		t.Errorf("expected a client that sent an unmasked frame to be disconnected: %v", err)
+	}
+	raw.Close()
+
+	//A browser that doesn't read what it is sent can't hold up the run
+	stalled, err := web.Dial("ws" + strings.TrimPrefix(srv.URL, "http") + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stalled.Close()
+
+	first := openTab(t, srv, p)
+	if err := first.conn.WriteMessage([]byte("p")); err != nil {
+		t.Fatal(err)
+	}
+	first.until(t, "Paused")
+	alive, turn, err := c.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.turn != turn {
+		t.Fatalf("the browser paused on turn %d, the run on turn %d", first.turn, turn)
+	}
+	assertEqualBoard(t, first.cells(), alive, p)
+
+	second := openTab(t, srv, p)
+	if second.turn != turn {
+		t.Errorf("a browser that connected on turn %d was sent turn %d", turn, second.turn)
+	}
+	assertEqualBoard(t, second.cells(), alive, p)
+
+	if err := second.conn.WriteMessage([]byte("p")); err != nil {
+		t.Fatal(err)
+	}
+	first.until(t, "Executing")
+	if err := first.conn.WriteMessage([]byte("q")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	for m := first.next(t); !m.Done; m = first.next(t) {
+	}
+	if _, err := first.conn.ReadMessage(); err == nil {
+		t.Error("expected the connection to be closed after the last message")
+	}
+	expected := p
+	expected.Turns = first.turn
+	assertEqualBoard(t, first.cells(), runFinal(expected), p)
+	stalled.Close()
+	viewer.Wait()
+}
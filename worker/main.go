@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+
+	"uk.ac.bris.cs/gameoflife/gol"
+)
+
+// main starts a worker and registers it with a broker,
+// e.g. 'go run ./worker -listen 127.0.0.1:8031 -broker 127.0.0.1:8030'
+func main() {
+	listen := flag.String(
+		"listen",
+		"127.0.0.1:8031",
+		"Specify the address to accept the broker and other workers on, which they must be able to reach. Defaults to 127.0.0.1:8031.")
+
+	broker := flag.String(
+		"broker",
+		"127.0.0.1:8030",
+		"Specify the address of the broker to register with. Defaults to 127.0.0.1:8030.")
+
+	flag.Parse()
+
+	l, err := net.Listen("tcp", *listen)
+	if err == nil {
+		err = gol.ServeWorker(l, *broker)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}